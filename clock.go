@@ -0,0 +1,48 @@
+package goprocess
+
+import (
+	"time"
+)
+
+// Clock is the source of time of the timers of a process or supervisor, see WithClock and WithSupervisorClock. It allows tests to advance time manually instead of sleeping, e.g. with the clock of the goprocesstest package. It must be safe for concurrent use.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer creates a timer which sends the current time on its channel after the duration.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer created by a Clock, like time.Timer.
+type Timer interface {
+	// C returns the channel on which the time is sent when the timer fires.
+	C() <-chan time.Time
+	// Stop prevents the timer from firing. It returns false if the timer already fired or has been stopped.
+	Stop() bool
+}
+
+// realClock is the clock of the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// clock returns the clock given by WithClock or the real clock.
+func (p *Process) clock() Clock {
+	if p.options.clock != nil {
+		return p.options.clock
+	}
+	return realClock{}
+}
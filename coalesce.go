@@ -0,0 +1,75 @@
+package goprocess
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// coalescer suppresses consecutive duplicate lines. The repeats are summarized once a different line arrives, periodically and when the stream ends.
+type coalescer struct {
+	// interval is the interval of the periodic summaries, 0 disables them
+	interval time.Duration
+	// summarize delivers the summary of the repeats, it is called with the mutex held
+	summarize func(repeated int)
+
+	mutex    sync.Mutex
+	last     []byte
+	hasLast  bool
+	repeated int
+	timer    *time.Timer
+	closed   bool
+}
+
+// allow returns whether the line may be delivered, i.e. it does not repeat the previous line.
+func (c *coalescer) allow(line []byte) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.hasLast && bytes.Equal(line, c.last) {
+		c.repeated++
+		if c.interval > 0 && c.timer == nil {
+			c.timer = time.AfterFunc(c.interval, func() {
+				c.mutex.Lock()
+				defer c.mutex.Unlock()
+				if !c.closed {
+					c.flush()
+				}
+			})
+		}
+		return false
+	}
+	c.flush()
+	c.last = append(c.last[:0], line...)
+	c.hasLast = true
+	return true
+}
+
+// close summarizes the pending repeats. Afterwards nothing is summarized anymore.
+func (c *coalescer) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.flush()
+	c.closed = true
+}
+
+func (c *coalescer) flush() {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if c.repeated > 0 {
+		c.summarize(c.repeated)
+		c.repeated = 0
+	}
+}
+
+// newStderrCoalescer creates the coalescer for stderr configured by WithStderrCoalesce.
+func (p *Process) newStderrCoalescer() *coalescer {
+	return &coalescer{
+		interval: p.options.stderrCoalesceInterval,
+		summarize: func(repeated int) {
+			p.deliverSummary(&p.stderr, fmt.Sprintf("last message repeated %d times", repeated))
+		},
+	}
+}
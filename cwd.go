@@ -0,0 +1,10 @@
+package goprocess
+
+// CurrentDir returns the current working directory of the running process, which may differ from the directory set by WithDir if the process changed it. It is supported on Linux only, where the directory is read from /proc; other platforms return ErrNotSupported. Like OpenFDs, the result is a snapshot and reading it usually requires being the owner of the process.
+func (p *Process) CurrentDir() (string, error) {
+	pid := p.Pid()
+	if pid == 0 {
+		return "", ErrNotStarted
+	}
+	return currentDir(pid)
+}
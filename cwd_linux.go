@@ -0,0 +1,11 @@
+package goprocess
+
+import (
+	"os"
+	"strconv"
+)
+
+// currentDir returns the working directory of the process, read from /proc.
+func currentDir(pid int) (string, error) {
+	return os.Readlink("/proc/" + strconv.Itoa(pid) + "/cwd")
+}
@@ -0,0 +1,8 @@
+//go:build unix && !linux
+
+package goprocess
+
+// currentDir is not supported on this platform.
+func currentDir(pid int) (string, error) {
+	return "", ErrNotSupported
+}
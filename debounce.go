@@ -0,0 +1,81 @@
+package goprocess
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// debouncer limits the number of lines delivered per time window. The suppressed lines are summarized at the end of each window.
+type debouncer struct {
+	window time.Duration
+	max    int
+	// summarize delivers the summary of the suppressed lines, it is called with the mutex held
+	summarize func(suppressed int)
+
+	mutex      sync.Mutex
+	start      time.Time
+	count      int
+	suppressed int
+	timer      *time.Timer
+	closed     bool
+}
+
+// allow counts a line and returns whether it may be delivered.
+func (d *debouncer) allow() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	now := time.Now()
+	if d.count == 0 || now.Sub(d.start) >= d.window {
+		d.flush()
+		d.start = now
+		d.count = 0
+	}
+	d.count++
+	if d.count <= d.max {
+		return true
+	}
+	d.suppressed++
+	if d.timer == nil {
+		start := d.start
+		d.timer = time.AfterFunc(start.Add(d.window).Sub(now), func() {
+			d.mutex.Lock()
+			defer d.mutex.Unlock()
+			// the timer may fire late, after the next window started
+			if !d.closed && d.start.Equal(start) {
+				d.flush()
+			}
+		})
+	}
+	return false
+}
+
+// close summarizes the lines suppressed in the current window. Afterwards nothing is summarized anymore.
+func (d *debouncer) close() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.flush()
+	d.closed = true
+}
+
+func (d *debouncer) flush() {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	if d.suppressed > 0 {
+		d.summarize(d.suppressed)
+		d.suppressed = 0
+	}
+}
+
+// newStderrDebouncer creates the debouncer for stderr configured by WithStderrDebounce.
+func (p *Process) newStderrDebouncer() *debouncer {
+	return &debouncer{
+		window: p.options.stderrDebounceWindow,
+		max:    p.options.stderrDebounceMax,
+		summarize: func(suppressed int) {
+			p.deliverSummary(&p.stderr, fmt.Sprintf("%d lines suppressed", suppressed))
+		},
+	}
+}
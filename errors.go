@@ -0,0 +1,156 @@
+package goprocess
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"syscall"
+)
+
+var (
+	// ErrNotStarted is returned when interacting with a process which has not been started yet.
+	ErrNotStarted = errors.New("process not started")
+	// ErrAlreadyStarted is returned when starting a process a second time.
+	ErrAlreadyStarted = errors.New("process already started")
+	// ErrStdinClosed is returned when writing to the stdin of a process after its stdin-channel has been closed.
+	ErrStdinClosed = errors.New("stdin closed")
+	// ErrNotFound is wrapped by the error returned when starting a process fails because its executable does not exist.
+	ErrNotFound = errors.New("executable not found")
+	// ErrPermission is wrapped by the error returned when starting a process fails because its executable may not be executed.
+	ErrPermission = errors.New("permission denied")
+	// ErrBinaryBusy is wrapped by the error returned when starting a process fails because its executable is opened for writing (ETXTBSY), e.g. while it is still being copied. The start may succeed when it is retried.
+	ErrBinaryBusy = errors.New("executable busy")
+	// ErrExecFormat is wrapped by the error returned when starting a process fails because its executable has no format the system can execute (ENOEXEC), e.g. a script without shebang line or a binary for another platform.
+	ErrExecFormat = errors.New("exec format error")
+	// ErrExecutableNotAllowed is wrapped by the error returned when creating a process whose executable is not in the allowlist of WithAllowedExecutables.
+	ErrExecutableNotAllowed = errors.New("executable not allowed")
+	// ErrStart is wrapped by the error returned when starting a process fails for any other reason.
+	ErrStart = errors.New("starting process failed")
+	// ErrStartTimeout is wrapped by the error returned when starting a process did not complete within the timeout set by WithStartTimeout.
+	ErrStartTimeout = errors.New("start timed out")
+	// ErrStdinWrite is wrapped by the errors reported on the error channel when writing a message of the stdin-channel failed.
+	ErrStdinWrite = errors.New("writing stdin failed")
+	// ErrNoRequestDelimiter is returned by EndRequest if no delimiter has been set by WithRequestDelimiter.
+	ErrNoRequestDelimiter = errors.New("no request delimiter")
+	// ErrStdinClosedByProcess is wrapped by the error reported on the error channel when the process closed its end of the stdin-pipe, see Process.StdinClosedByProcess. The error wraps ErrStdinWrite as well.
+	ErrStdinClosedByProcess = errors.New("stdin closed by process")
+	// ErrStdinStalled is wrapped by the error reported on the error channel when a write to stdin is pending longer than the threshold set by WithStdinStallWarn.
+	ErrStdinStalled = errors.New("stdin stalled")
+	// ErrStartupSilence is wrapped by the error reported on the error channel when the process is terminated because it did not produce any output within the timeout set by WithStartupSilenceTimeout.
+	ErrStartupSilence = errors.New("no output after start")
+	// ErrExited is the cause of the context returned by Process.Context, wrapped together with the error of the exit if the process exited unsuccessfully.
+	ErrExited = errors.New("process exited")
+	// ErrOutputTooLarge is wrapped by the error reported on the error channel when the output exceeds the maximum size set by WithStdoutWhole.
+	ErrOutputTooLarge = errors.New("output too large")
+	// ErrTeeWrite is wrapped by the errors reported on the error channel when writing output to the writer set by Process.SetStdoutTee or Process.SetStderrTee failed.
+	ErrTeeWrite = errors.New("writing tee failed")
+	// ErrStdinTruncated is matched by errors.Is for a *StdinTruncatedError.
+	ErrStdinTruncated = errors.New("stdin truncated")
+	// ErrNonZeroExit is matched by errors.Is for an *ExitError.
+	ErrNonZeroExit = errors.New("non-zero exit")
+	// ErrNotInProcessGroup is wrapped by the error returned by Process.SignalPid when the pid is neither the process nor a member of its process group.
+	ErrNotInProcessGroup = errors.New("pid not in process group")
+	// ErrNotSupported is returned by functionality which is not available on the platform.
+	ErrNotSupported = errors.New("not supported on this platform")
+)
+
+// classifyStartError wraps an error returned by exec.Cmd.Start with the matching start error. The original error stays accessible via errors.Is and errors.As.
+func classifyStartError(err error) error {
+	switch {
+	case errors.Is(err, exec.ErrNotFound), errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case errors.Is(err, fs.ErrPermission):
+		return fmt.Errorf("%w: %w", ErrPermission, err)
+	case errors.Is(err, syscall.ETXTBSY):
+		return fmt.Errorf("%w: %w", ErrBinaryBusy, err)
+	case errors.Is(err, syscall.ENOEXEC):
+		return fmt.Errorf("%w: %w", ErrExecFormat, err)
+	}
+	return fmt.Errorf("%w: %w", ErrStart, err)
+}
+
+// errorsBufferSize is the capacity of the error channel.
+const errorsBufferSize = 16
+
+// Errors returns a channel on which errors occurring in the background are reported, e.g. failed writes of messages of the stdin-channel (wrapping ErrStdinWrite). The errors are sent without blocking: if the channel is full because nobody receives, further errors are dropped. The channel is never closed.
+func (p *Process) Errors() <-chan error {
+	return p.errors
+}
+
+// reportError sends the error on the error channel, dropping it if the channel is full.
+func (p *Process) reportError(err error) {
+	select {
+	case p.errors <- err:
+	default:
+	}
+}
+
+// retryable returns whether the error of a write is transient, so that the write can be retried.
+func retryable(err error) bool {
+	return errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR)
+}
+
+// stderrErrorLines is the number of lines of stderr retained for a StderrError if WithRecentLines is not given.
+const stderrErrorLines = 10
+
+// StderrError is the error of a process which exited successfully but wrote to stderr, see WithStderrAsError.
+type StderrError struct {
+	// Stderr are the last lines written to stderr up to the exit, see Process.RecentStderr.
+	Stderr [][]byte
+}
+
+func (e *StderrError) Error() string {
+	if len(e.Stderr) == 0 {
+		return "process wrote to stderr"
+	}
+	return "process wrote to stderr: " + string(e.Stderr[len(e.Stderr)-1])
+}
+
+// stderrError returns a StderrError if the process wrote to stderr. It waits until a line of stderr has been read or stderr has been closed.
+func (p *Process) stderrError() error {
+	<-p.stderr.written
+	if !p.stderr.hasLines.Load() {
+		return nil
+	}
+	return &StderrError{Stderr: p.RecentStderr(p.stderr.recent.size())}
+}
+
+// ExitError is the error of a process run by RunExpectZero which did not exit with code 0.
+type ExitError struct {
+	// Code is the exit code of the process, or -1 if the process has been terminated by a signal.
+	Code int
+	// Stderr is the output written to stderr.
+	Stderr []byte
+}
+
+func (e *ExitError) Error() string {
+	message := fmt.Sprintf("process exited with code %d", e.Code)
+	if len(e.Stderr) == 0 {
+		return message
+	}
+	return message + ": " + string(bytes.TrimSpace(e.Stderr))
+}
+
+// Is reports whether the target is ErrNonZeroExit.
+func (e *ExitError) Is(target error) bool {
+	return target == ErrNonZeroExit
+}
+
+// StdinTruncatedError is the error reported on the error channel when messages of the stdin-channel could not be written because the process exited before, e.g. because it stopped reading its input early. It tells producers of a batch that their input has not been consumed completely.
+//
+// Only messages whose write failed after the process has exited are counted; a write failing while the process is still running (e.g. because it closed its stdin) is reported by ErrStdinWrite or ErrStdinClosedByProcess only. On Linux, the exit is detected without reaping the process; on other platforms, a failed write waits shortly for the reaping to tell both cases apart. The error is reported once the stdin-channel has been closed and drained, so it is never reported for an owned stdin-channel which is not closed (see Process.Stdin): close the stdin-channel when the input is complete, also after the process exited.
+type StdinTruncatedError struct {
+	// Unsent is the number of messages of the stdin-channel which have not been written.
+	Unsent int
+}
+
+func (e *StdinTruncatedError) Error() string {
+	return fmt.Sprintf("stdin truncated: %d messages unsent", e.Unsent)
+}
+
+// Is reports whether the target is ErrStdinTruncated.
+func (e *StdinTruncatedError) Is(target error) bool {
+	return target == ErrStdinTruncated
+}
@@ -0,0 +1,38 @@
+package goprocess
+
+import (
+	"fmt"
+	"os"
+)
+
+// ExitStatus describes how the process exited, independently of the platform. On Unix platforms, the raw wait status is available via WaitStatus for platform-specific inspection.
+type ExitStatus struct {
+	// Code is the exit code of the process, or -1 if the process has been terminated by a signal.
+	Code int
+	// Signal is the signal which terminated the process, or nil if the process exited by itself.
+	Signal os.Signal
+	// CoreDumped is whether the process dumped core when it was terminated by the signal.
+	CoreDumped bool
+
+	state *os.ProcessState
+}
+
+// Exit returns a channel on which the exit status is sent once the process has exited and has been reaped. The channel is closed afterwards, so the status is received exactly once; further receivers get the zero value and should use ProcessState instead. Without reaping (see WithReaping), the channel is closed without sending a status.
+func (p *Process) Exit() <-chan ExitStatus {
+	return p.exit
+}
+
+// String describes the exit status in human-readable form, e.g. "exited with code 3" or "killed by signal: segmentation fault (SIGSEGV), core dumped". The raw values remain available in the fields for programmatic use.
+func (s ExitStatus) String() string {
+	if s.Signal == nil {
+		return fmt.Sprintf("exited with code %d", s.Code)
+	}
+	description := "killed by signal: " + s.Signal.String()
+	if name := signalName(s.Signal); name != "" {
+		description += " (" + name + ")"
+	}
+	if s.CoreDumped {
+		description += ", core dumped"
+	}
+	return description
+}
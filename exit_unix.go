@@ -0,0 +1,70 @@
+//go:build unix
+
+package goprocess
+
+import (
+	"os"
+	"syscall"
+)
+
+// newExitStatus summarizes the state of the exited process.
+func newExitStatus(state *os.ProcessState) ExitStatus {
+	status := ExitStatus{Code: state.ExitCode(), state: state}
+	waitStatus, ok := state.Sys().(syscall.WaitStatus)
+	if ok && waitStatus.Signaled() {
+		status.Signal = waitStatus.Signal()
+		status.CoreDumped = waitStatus.CoreDump()
+	}
+	return status
+}
+
+// WaitStatus returns the raw wait status of the exited process, e.g. to inspect Stopped or TrapCause. It returns false if the status does not belong to an exited process (i.e. it is the zero value).
+func (s ExitStatus) WaitStatus() (syscall.WaitStatus, bool) {
+	if s.state == nil {
+		return 0, false
+	}
+	waitStatus, ok := s.state.Sys().(syscall.WaitStatus)
+	return waitStatus, ok
+}
+
+// signalNames are the names of the common signals.
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGABRT:   "SIGABRT",
+	syscall.SIGALRM:   "SIGALRM",
+	syscall.SIGBUS:    "SIGBUS",
+	syscall.SIGCHLD:   "SIGCHLD",
+	syscall.SIGCONT:   "SIGCONT",
+	syscall.SIGFPE:    "SIGFPE",
+	syscall.SIGHUP:    "SIGHUP",
+	syscall.SIGILL:    "SIGILL",
+	syscall.SIGINT:    "SIGINT",
+	syscall.SIGIO:     "SIGIO",
+	syscall.SIGKILL:   "SIGKILL",
+	syscall.SIGPIPE:   "SIGPIPE",
+	syscall.SIGPROF:   "SIGPROF",
+	syscall.SIGQUIT:   "SIGQUIT",
+	syscall.SIGSEGV:   "SIGSEGV",
+	syscall.SIGSTOP:   "SIGSTOP",
+	syscall.SIGSYS:    "SIGSYS",
+	syscall.SIGTERM:   "SIGTERM",
+	syscall.SIGTRAP:   "SIGTRAP",
+	syscall.SIGTSTP:   "SIGTSTP",
+	syscall.SIGTTIN:   "SIGTTIN",
+	syscall.SIGTTOU:   "SIGTTOU",
+	syscall.SIGURG:    "SIGURG",
+	syscall.SIGUSR1:   "SIGUSR1",
+	syscall.SIGUSR2:   "SIGUSR2",
+	syscall.SIGVTALRM: "SIGVTALRM",
+	syscall.SIGWINCH:  "SIGWINCH",
+	syscall.SIGXCPU:   "SIGXCPU",
+	syscall.SIGXFSZ:   "SIGXFSZ",
+}
+
+// signalName returns the name of the signal, e.g. "SIGSEGV", or an empty string if the name is unknown.
+func signalName(signal os.Signal) string {
+	s, ok := signal.(syscall.Signal)
+	if !ok {
+		return ""
+	}
+	return signalNames[s]
+}
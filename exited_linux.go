@@ -0,0 +1,23 @@
+package goprocess
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// pPid is the idtype P_PID of waitid(2), which selects the child by its pid.
+const pPid = 1
+
+// processExited returns whether the child with the pid has exited, without reaping it (waitid with WNOWAIT). A child which has already been reaped counts as exited.
+func processExited(pid int) (bool, error) {
+	// siginfo_t has a size of 128 bytes, its first field si_signo is set to SIGCHLD if the child is waitable
+	var info [128]byte
+	_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, pPid, uintptr(pid), uintptr(unsafe.Pointer(&info[0])), syscall.WEXITED|syscall.WNOHANG|syscall.WNOWAIT, 0, 0)
+	if errno == syscall.ECHILD {
+		return true, nil
+	}
+	if errno != 0 {
+		return false, errno
+	}
+	return *(*int32)(unsafe.Pointer(&info[0])) == int32(syscall.SIGCHLD), nil
+}
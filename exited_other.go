@@ -0,0 +1,8 @@
+//go:build unix && !linux
+
+package goprocess
+
+// processExited is not supported on this platform.
+func processExited(pid int) (bool, error) {
+	return false, ErrNotSupported
+}
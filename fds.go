@@ -0,0 +1,18 @@
+package goprocess
+
+// FDInfo describes an open file descriptor of a process.
+type FDInfo struct {
+	// FD is the number of the file descriptor.
+	FD int
+	// Target is what the file descriptor refers to, e.g. a path, "pipe:[1234]" or "socket:[5678]".
+	Target string
+}
+
+// OpenFDs returns the open file descriptors of the running process ordered by number, e.g. for diagnosing file descriptor leaks. It is supported on Linux only, where the file descriptors are read from /proc; other platforms return ErrNotSupported. The result is a snapshot, and reading the file descriptors of a process usually requires being its owner.
+func (p *Process) OpenFDs() ([]FDInfo, error) {
+	pid := p.Pid()
+	if pid == 0 {
+		return nil, ErrNotStarted
+	}
+	return openFDs(pid)
+}
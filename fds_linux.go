@@ -0,0 +1,33 @@
+package goprocess
+
+import (
+	"os"
+	"sort"
+	"strconv"
+)
+
+// openFDs returns the open file descriptors of the process, read from /proc.
+func openFDs(pid int) ([]FDInfo, error) {
+	dir := "/proc/" + strconv.Itoa(pid) + "/fd/"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	fds := make([]FDInfo, 0, len(entries))
+	for _, entry := range entries {
+		fd, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		target, err := os.Readlink(dir + entry.Name())
+		if err != nil {
+			// the file descriptor has been closed in the meantime
+			continue
+		}
+		fds = append(fds, FDInfo{FD: fd, Target: target})
+	}
+	sort.Slice(fds, func(i, j int) bool {
+		return fds[i].FD < fds[j].FD
+	})
+	return fds, nil
+}
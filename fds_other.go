@@ -0,0 +1,8 @@
+//go:build unix && !linux
+
+package goprocess
+
+// openFDs is not supported on this platform.
+func openFDs(pid int) ([]FDInfo, error) {
+	return nil, ErrNotSupported
+}
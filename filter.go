@@ -0,0 +1,55 @@
+package goprocess
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// prepareFilter prepares the filter of WithOutputThrough: the stdout of the command (and stderr with combined output) is redirected to a pipe read by the filter, which writes to the former stdout and stderr of the command. It returns the filter, the files to be closed once the command has been started and the files to be closed once the filter has been started.
+func (p *Process) prepareFilter(command *exec.Cmd, files *pipes) (*exec.Cmd, []*os.File, []*os.File, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		closeFiles(files.child...)
+		closeFiles(files.parent...)
+		return nil, nil, nil, err
+	}
+	filter := exec.Command(p.options.outputFilter[0], p.options.outputFilter[1:]...)
+	filter.Dir = p.options.dir
+	filter.Stdin = reader
+	filter.Stdout = command.Stdout
+	filter.Stderr = command.Stderr
+	if command.Stderr == command.Stdout {
+		// with combined output, stderr of the process goes through the filter as well, like "process 2>&1 | filter"
+		command.Stderr = writer
+	}
+	command.Stdout = writer
+	// the ends of the pipes used by the filter must stay open until the filter has been started
+	filterFiles := []*os.File{reader}
+	commandFiles := []*os.File{writer}
+	for _, file := range files.child {
+		if file == filter.Stdout || file == filter.Stderr {
+			filterFiles = append(filterFiles, file)
+		} else {
+			commandFiles = append(commandFiles, file)
+		}
+	}
+	return filter, commandFiles, filterFiles, nil
+}
+
+// startFilter starts the filter of WithOutputThrough after the process has been started. The filter joins the process group of the process, so that signals sent to the group reach both. If the filter cannot be started, the process is killed and reaped.
+func (p *Process) startFilter(filter *exec.Cmd, filterFiles []*os.File, parentFiles []*os.File) error {
+	if p.groupLeader {
+		filter.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pgid: p.command.Process.Pid}
+	}
+	err := filter.Start()
+	closeFiles(filterFiles...)
+	if err != nil {
+		closeFiles(parentFiles...)
+		p.command.Process.Kill()
+		p.command.Wait()
+		return classifyStartError(err)
+	}
+	p.filter = filter
+	return nil
+}
@@ -0,0 +1,3 @@
+module github.com/NIPE-SYSTEMS/goprocess
+
+go 1.23
@@ -0,0 +1,109 @@
+package goprocesstest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/NIPE-SYSTEMS/goprocess"
+)
+
+// Clock is a clock implementing goprocess.Clock whose time only advances when the test calls Advance. It makes the timers of a process or supervisor deterministic, e.g.:
+//
+//	clock := goprocesstest.NewClock(time.Now())
+//	p, _ := goprocess.StartProcess(args, nil, nil, goprocess.WithClock(clock))
+//	go p.Terminate(time.Minute)
+//	clock.BlockUntil(1)
+//	clock.Advance(time.Minute) // the grace period is over
+type Clock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*timer
+	// changed is closed and replaced whenever a timer is created
+	changed chan struct{}
+}
+
+// NewClock creates a clock starting at the given time.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now, changed: make(chan struct{})}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// NewTimer creates a timer firing once the clock has been advanced by the duration.
+func (c *Clock) NewTimer(d time.Duration) goprocess.Timer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	t := &timer{clock: c, at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+		return t
+	}
+	c.timers = append(c.timers, t)
+	close(c.changed)
+	c.changed = make(chan struct{})
+	return t
+}
+
+// Advance advances the clock by the duration and fires the timers which are due.
+func (c *Clock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- c.now
+	}
+	c.timers = pending
+}
+
+// Timers returns the number of timers which have neither fired nor been stopped.
+func (c *Clock) Timers() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.timers)
+}
+
+// BlockUntil blocks until at least n timers are pending, e.g. to make sure the code under test set its timer before advancing the clock.
+func (c *Clock) BlockUntil(n int) {
+	for {
+		c.mutex.Lock()
+		pending, changed := len(c.timers), c.changed
+		c.mutex.Unlock()
+		if pending >= n {
+			return
+		}
+		<-changed
+	}
+}
+
+// timer is a timer of a Clock.
+type timer struct {
+	clock *Clock
+	at    time.Time
+	c     chan time.Time
+}
+
+func (t *timer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *timer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	for i, pending := range t.clock.timers {
+		if pending == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
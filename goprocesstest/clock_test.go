@@ -0,0 +1,102 @@
+package goprocesstest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NIPE-SYSTEMS/goprocess"
+)
+
+// TestClockTerminate tests if the grace period of Terminate elapses on the clock. The test succeeds if a process ignoring SIGTERM is killed once the clock has been advanced by the grace period, without waiting for it in real time.
+func TestClockTerminate(t *testing.T) {
+	clock := NewClock(time.Now())
+	p, err := goprocess.StartProcess([]string{"sh", "-c", "trap '' TERM; echo ready; while true; do sleep 0.01; done"}, nil, nil, goprocess.WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go goprocess.Drain(p.Stderr())
+	<-p.Stdout()
+	go goprocess.Drain(p.Stdout())
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Terminate(time.Hour)
+	}()
+	clock.BlockUntil(1)
+	select {
+	case <-p.Done():
+		t.Fatal("Process exited before the grace period elapsed.")
+	case <-time.After(50 * time.Millisecond):
+	}
+	clock.Advance(time.Hour)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Terminate did not return within 5 seconds after the grace period elapsed.")
+	}
+}
+
+// TestClockSupervisorBackoff tests if the backoff of a supervisor elapses on the clock. The test succeeds if the process is only restarted once the clock has been advanced by the backoff.
+func TestClockSupervisorBackoff(t *testing.T) {
+	clock := NewClock(time.Now())
+	s := goprocess.NewSupervisor(func() (*goprocess.Process, error) {
+		return goprocess.New([]string{"true"})
+	}, goprocess.WithRestartBackoff(time.Hour, time.Hour), goprocess.WithRestartLimit(1, 0), goprocess.WithSupervisorClock(clock))
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go goprocess.Drain(s.Stdout())
+	go goprocess.Drain(s.Stderr())
+	clock.BlockUntil(1)
+	first := s.Process()
+	clock.Advance(time.Hour)
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Supervisor did not give up within 5 seconds.")
+	}
+	if s.Restarts() != 1 || s.Process() == first {
+		t.Fatalf("Supervisor restarted %d times, expected 1 restart.", s.Restarts())
+	}
+}
+
+// TestClockSupervisorStableWindow tests if the backoff keeps growing while the process crashes within the stable window. The test succeeds if the delays between the restarts double.
+func TestClockSupervisorStableWindow(t *testing.T) {
+	clock := NewClock(time.Now())
+	var mutex sync.Mutex
+	var restarts []time.Time
+	s := goprocess.NewSupervisor(func() (*goprocess.Process, error) {
+		return goprocess.New([]string{"true"})
+	}, goprocess.WithRestartBackoff(time.Second, time.Hour), goprocess.WithStableWindow(time.Hour), goprocess.WithRestartLimit(3, 0), goprocess.WithSupervisorClock(clock), goprocess.WithPreRestart(func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		restarts = append(restarts, clock.Now())
+	}))
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go goprocess.Drain(s.Stdout())
+	go goprocess.Drain(s.Stderr())
+	for {
+		select {
+		case <-s.Done():
+		case <-time.After(time.Millisecond):
+			clock.Advance(10 * time.Millisecond)
+			continue
+		}
+		break
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(restarts) != 3 {
+		t.Fatalf("Supervisor restarted %d times, expected %d restarts.", len(restarts), 3)
+	}
+	if gap := restarts[2].Sub(restarts[1]); gap < 4*time.Second {
+		t.Fatalf("Supervisor waited %v before the third restart, expected at least %v.", gap, 4*time.Second)
+	}
+}
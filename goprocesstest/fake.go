@@ -0,0 +1,211 @@
+// Package goprocesstest provides a fake process for testing code which uses goprocess without running real processes.
+package goprocesstest
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/NIPE-SYSTEMS/goprocess"
+)
+
+// ErrTerminated is the result of Wait of a fake which has been stopped by Terminate or Kill.
+var ErrTerminated = errors.New("fake process terminated")
+
+// Fake is a fake process implementing goprocess.Interface. The test drives its stdout and stderr (WriteStdout, WriteStderr), inspects what has been written to its stdin (Received) and lets it exit (Exit). Like a real process, it has to be started before it consumes its stdin.
+type Fake struct {
+	pid      int
+	stdin    chan []byte
+	stdout   chan []byte
+	stderr   chan []byte
+	received chan []byte
+
+	mutex       sync.Mutex
+	started     bool
+	stdinClosed chan struct{}
+	waitErr     error
+	exited      bool
+	terminated  bool
+	exiting     chan struct{}
+	done        chan struct{}
+
+	// sending is held for reading by WriteStdout and WriteStderr, so that Exit closes the channels only after the pending sends have been given up
+	sending sync.RWMutex
+}
+
+// New creates a new fake process which is not started yet. The stdout- and stderr-channels are unbuffered, so every line written by WriteStdout or WriteStderr has been received by the code under test when the call returns.
+func New() *Fake {
+	return &Fake{
+		pid:         4242,
+		stdin:       make(chan []byte),
+		stdout:      make(chan []byte),
+		stderr:      make(chan []byte),
+		received:    make(chan []byte, 1024),
+		stdinClosed: make(chan struct{}),
+		exiting:     make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+var _ goprocess.Interface = (*Fake)(nil)
+
+// Start starts consuming the stdin-channel. A fake can only be started once.
+func (f *Fake) Start() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.started {
+		return goprocess.ErrAlreadyStarted
+	}
+	f.started = true
+	go func() {
+		for msg := range f.stdin {
+			f.received <- msg
+		}
+		close(f.stdinClosed)
+	}()
+	return nil
+}
+
+// Stdin returns the stdin-channel. The messages sent on it are received by Received.
+func (f *Fake) Stdin() chan<- []byte {
+	return f.stdin
+}
+
+// WriteLine passes the message to Received like a message of the stdin-channel.
+func (f *Fake) WriteLine(msg []byte) error {
+	f.mutex.Lock()
+	started := f.started
+	f.mutex.Unlock()
+	if !started {
+		return goprocess.ErrNotStarted
+	}
+	select {
+	case <-f.stdinClosed:
+		return goprocess.ErrStdinClosed
+	default:
+	}
+	f.received <- msg
+	return nil
+}
+
+// Stdout returns the stdout-channel, which receives the lines of WriteStdout.
+func (f *Fake) Stdout() <-chan []byte {
+	return f.stdout
+}
+
+// Stderr returns the stderr-channel, which receives the lines of WriteStderr.
+func (f *Fake) Stderr() <-chan []byte {
+	return f.stderr
+}
+
+// Pid returns a fixed fake pid. It returns 0 before the fake has been started.
+func (f *Fake) Pid() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !f.started {
+		return 0
+	}
+	return f.pid
+}
+
+// Terminate lets the fake exit with ErrTerminated.
+func (f *Fake) Terminate(grace time.Duration) error {
+	return f.stop()
+}
+
+// Kill lets the fake exit with ErrTerminated.
+func (f *Fake) Kill() error {
+	return f.stop()
+}
+
+func (f *Fake) stop() error {
+	f.mutex.Lock()
+	started := f.started
+	if started {
+		f.terminated = true
+	}
+	f.mutex.Unlock()
+	if !started {
+		return goprocess.ErrNotStarted
+	}
+	f.Exit(ErrTerminated)
+	return nil
+}
+
+// Wait blocks until the fake has exited and returns the error given to Exit. It returns goprocess.ErrNotStarted if the fake has not been started.
+func (f *Fake) Wait() error {
+	f.mutex.Lock()
+	started := f.started
+	f.mutex.Unlock()
+	if !started {
+		return goprocess.ErrNotStarted
+	}
+	<-f.done
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.waitErr
+}
+
+// Done returns a channel which is closed when the fake has exited.
+func (f *Fake) Done() <-chan struct{} {
+	return f.done
+}
+
+// WriteStdout sends the line on the stdout-channel. It blocks until the line has been received. The line is dropped if the fake exits before.
+func (f *Fake) WriteStdout(line []byte) {
+	f.write(f.stdout, line)
+}
+
+// WriteStderr sends the line on the stderr-channel. It blocks until the line has been received. The line is dropped if the fake exits before.
+func (f *Fake) WriteStderr(line []byte) {
+	f.write(f.stderr, line)
+}
+
+func (f *Fake) write(channel chan []byte, line []byte) {
+	f.sending.RLock()
+	defer f.sending.RUnlock()
+	select {
+	case <-f.exiting:
+		return
+	default:
+	}
+	select {
+	case channel <- line:
+	case <-f.exiting:
+	}
+}
+
+// Received returns the channel on which the messages written to the stdin of the fake are received, in the order they have been written.
+func (f *Fake) Received() <-chan []byte {
+	return f.received
+}
+
+// StdinClosed returns a channel which is closed when the stdin-channel has been closed and all of its messages have been received.
+func (f *Fake) StdinClosed() <-chan struct{} {
+	return f.stdinClosed
+}
+
+// Terminated returns whether the fake has been stopped by Terminate or Kill.
+func (f *Fake) Terminated() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.terminated
+}
+
+// Exit lets the fake exit: the stdout- and stderr-channels are closed and Wait returns the error, e.g. an error for an unsuccessful exit or nil. Only the first call has an effect.
+func (f *Fake) Exit(err error) {
+	f.mutex.Lock()
+	if f.exited {
+		f.mutex.Unlock()
+		return
+	}
+	f.exited = true
+	f.waitErr = err
+	close(f.exiting)
+	f.mutex.Unlock()
+	f.sending.Lock()
+	close(f.stdout)
+	close(f.stderr)
+	f.sending.Unlock()
+	close(f.done)
+}
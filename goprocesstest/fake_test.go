@@ -0,0 +1,67 @@
+package goprocesstest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/NIPE-SYSTEMS/goprocess"
+)
+
+// echo is code under test: it writes every line received from stdout of the process back to its stdin until stdout is closed.
+func echo(p goprocess.Interface) error {
+	err := p.Start()
+	if err != nil {
+		return err
+	}
+	for line := range p.Stdout() {
+		p.Stdin() <- line
+	}
+	close(p.Stdin())
+	return p.Wait()
+}
+
+// TestFake tests if the fake can be driven by a test. The test succeeds if the lines written to stdout of the fake are received on its stdin, the stdin is closed and the error of the exit is returned by Wait.
+func TestFake(t *testing.T) {
+	f := New()
+	result := make(chan error)
+	go func() {
+		result <- echo(f)
+	}()
+	f.WriteStdout([]byte("foo"))
+	msg := <-f.Received()
+	if string(msg) != "foo" {
+		t.Fatalf("Fake received %q on stdin, expected %q.", msg, "foo")
+	}
+	exitErr := errors.New("exit status 1")
+	f.Exit(exitErr)
+	<-f.StdinClosed()
+	if err := <-result; err != exitErr {
+		t.Fatalf("Wait returned %v, expected %v.", err, exitErr)
+	}
+}
+
+// TestFakeExit tests if the fake exits safely. The test succeeds if Wait fails before the start, and writes pending while the fake exits return without a panic.
+func TestFakeExit(t *testing.T) {
+	f := New()
+	if err := f.Wait(); err != goprocess.ErrNotStarted {
+		t.Fatalf("Wait before the start returned %v, expected %v.", err, goprocess.ErrNotStarted)
+	}
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+	written := make(chan struct{})
+	for range 10 {
+		go func() {
+			f.WriteStdout([]byte("foo"))
+			f.WriteStderr([]byte("bar"))
+			written <- struct{}{}
+		}()
+	}
+	f.Exit(nil)
+	for range 10 {
+		<-written
+	}
+	if err := f.Wait(); err != nil {
+		t.Fatalf("Wait returned %v, expected nil.", err)
+	}
+}
@@ -0,0 +1,97 @@
+package goprocess
+
+// Consumer is the exclusive consumer of the stdout- and stderr-channels of a process, created by Process.Handoff.
+type Consumer struct {
+	stdout chan []byte
+	stderr chan []byte
+}
+
+// Stdout returns the channel on which the consumer receives the lines of stdout. It is closed once the process closed stdout or the output has been handed off to the next consumer. It returns nil if the process has no stdout-channel.
+func (c *Consumer) Stdout() <-chan []byte {
+	return c.stdout
+}
+
+// Stderr returns the channel on which the consumer receives the lines of stderr. See Stdout.
+func (c *Consumer) Stderr() <-chan []byte {
+	return c.stderr
+}
+
+// Handoff hands the output of the process off to a new consumer, e.g. to a new owner goroutine after a module of a long-running service has been reloaded. The channels of the previous consumer are closed, so that its receive loops end.
+//
+// Every line is received by exactly one consumer: the channels of a consumer are unbuffered, and once Handoff returns, no line is sent to the previous consumer anymore. A line which is being sent to the previous consumer at the hand-off point is delivered to the new consumer instead. Lines buffered in the stdout- and stderr-channels of the process are not affected and received by the new consumer. Lines the previous consumer received before are its own responsibility.
+//
+// After the first call of Handoff, the stdout- and stderr-channels returned by Stdout and Stderr must not be received from directly anymore, since the consumers receive from them.
+func (p *Process) Handoff() *Consumer {
+	p.handoffMutex.Lock()
+	defer p.handoffMutex.Unlock()
+	if p.handoffs == nil {
+		p.handoffs = []*handoffStream{newHandoffStream(p, p.stdout.lines), newHandoffStream(p, p.stderr.lines)}
+	}
+	return &Consumer{stdout: p.handoffs[0].next(), stderr: p.handoffs[1].next()}
+}
+
+// handoffStream forwards the lines of a stream to the current consumer.
+type handoffStream struct {
+	// swap receives the channel of the next consumer
+	swap chan chan []byte
+	// done is closed once the stream has been closed and forwarding has ended
+	done chan struct{}
+}
+
+// newHandoffStream starts forwarding the lines of the process. It returns nil if lines is nil.
+func newHandoffStream(p *Process, lines <-chan []byte) *handoffStream {
+	if lines == nil {
+		return nil
+	}
+	h := &handoffStream{swap: make(chan chan []byte), done: make(chan struct{})}
+	go h.forward(p, lines)
+	return h
+}
+
+// next creates the channel of the next consumer and switches forwarding to it. It returns nil if h is nil.
+func (h *handoffStream) next() chan []byte {
+	if h == nil {
+		return nil
+	}
+	target := make(chan []byte)
+	select {
+	case h.swap <- target:
+	case <-h.done:
+		close(target)
+	}
+	return target
+}
+
+// forward forwards the lines to the channel of the current consumer until the lines are closed. A line is held until it has been received, by the current consumer or the next one. Without copied output, the held line is copied, since the scanner reuses its buffer once the next line has been received.
+func (h *handoffStream) forward(p *Process, lines <-chan []byte) {
+	defer close(h.done)
+	var target chan []byte
+	var pending []byte
+	hasPending := false
+	for {
+		var receive <-chan []byte
+		var send chan []byte
+		if hasPending {
+			send = target
+		} else {
+			receive = lines
+		}
+		select {
+		case line, ok := <-receive:
+			if !ok {
+				if target != nil {
+					close(target)
+				}
+				return
+			}
+			pending, hasPending = ownLine(p, line), true
+		case send <- pending:
+			pending, hasPending = nil, false
+		case next := <-h.swap:
+			if target != nil {
+				close(target)
+			}
+			target = next
+		}
+	}
+}
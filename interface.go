@@ -0,0 +1,31 @@
+package goprocess
+
+import (
+	"time"
+)
+
+// Interface is the behavior of a process as used by most callers. It is satisfied by *Process and by the fake of the goprocesstest package, so code which depends on Interface instead of *Process can be tested without running real processes.
+type Interface interface {
+	// Start launches the process, see Process.Start.
+	Start() error
+	// Stdin returns the stdin-channel owned by the process, see Process.Stdin.
+	Stdin() chan<- []byte
+	// WriteLine writes a line to stdin synchronously, see Process.WriteLine.
+	WriteLine(msg []byte) error
+	// Stdout returns the stdout-channel, see Process.Stdout.
+	Stdout() <-chan []byte
+	// Stderr returns the stderr-channel, see Process.Stderr.
+	Stderr() <-chan []byte
+	// Pid returns the pid of the process, see Process.Pid.
+	Pid() int
+	// Terminate stops the process gracefully, see Process.Terminate.
+	Terminate(grace time.Duration) error
+	// Kill stops the process immediately, see Process.Kill.
+	Kill() error
+	// Wait waits for the exit of the process, see Process.Wait.
+	Wait() error
+	// Done returns a channel which is closed when the process has exited, see Process.Done.
+	Done() <-chan struct{}
+}
+
+var _ Interface = (*Process)(nil)
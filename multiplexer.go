@@ -0,0 +1,64 @@
+package goprocess
+
+// TaggedLine is a line of a process merged by a Multiplexer, tagged with the name of the process.
+type TaggedLine struct {
+	// Name is the name under which the process has been added to the multiplexer.
+	Name string
+	// Stream is the output stream of the process the line has been read from.
+	Stream Stream
+	// Data is the line without the trailing newline.
+	Data []byte
+}
+
+// Multiplexer merges the output of many processes into a single channel, e.g. for a dashboard tailing all managed processes. It is assembled from the output channels of the processes.
+type Multiplexer struct {
+	output chan TaggedLine
+}
+
+// NewMultiplexer creates a new multiplexer without any processes.
+func NewMultiplexer() *Multiplexer {
+	return &Multiplexer{
+		output: make(chan TaggedLine, 1024),
+	}
+}
+
+// Output returns the channel on which the lines of all added processes are received. Lines of one stream of a process keep their order, lines of different processes and streams are interleaved in the order they are forwarded. The channel is never closed, since processes can be added at any time.
+func (m *Multiplexer) Output() <-chan TaggedLine {
+	return m.output
+}
+
+// Add starts consuming the output of the process (its stdout- and stderr-channels, or the channel returned by Lines if WithLines is given) and forwards it tagged with the name. The process may be added before or after it has been started, but the caller must not consume its output channels anymore. A process whose output is delivered to callbacks (WithStdoutFunc, WithStderrFunc) contributes only its remaining channels.
+//
+// The process is removed once its output channels have been closed, i.e. it exited; the other processes are not affected. Names need not be unique. Lines of a process created with WithCopyOutput(false) are copied, since they are buffered by the multiplexer.
+func (m *Multiplexer) Add(name string, p *Process) {
+	if lines := p.Lines(); lines != nil {
+		go func() {
+			for line := range lines {
+				m.output <- TaggedLine{Name: name, Stream: line.Stream, Data: ownLine(p, line.Data)}
+			}
+		}()
+		return
+	}
+	m.forward(p, name, StreamStdout, p.Stdout())
+	m.forward(p, name, StreamStderr, p.Stderr())
+}
+
+// forward forwards the lines of the channel tagged with the name and stream until the channel is closed.
+func (m *Multiplexer) forward(p *Process, name string, stream Stream, lines <-chan []byte) {
+	if lines == nil {
+		return
+	}
+	go func() {
+		for line := range lines {
+			m.output <- TaggedLine{Name: name, Stream: stream, Data: ownLine(p, line)}
+		}
+	}()
+}
+
+// ownLine copies the line if it is reused by the process for the next line.
+func ownLine(p *Process, line []byte) []byte {
+	if p.options.copyOutput {
+		return line
+	}
+	return append([]byte(nil), line...)
+}
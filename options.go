@@ -0,0 +1,664 @@
+package goprocess
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// Option configures a process created by New, StartProcess or NewProcess.
+type Option func(*options)
+
+type options struct {
+	stdin   <-chan []byte
+	signals <-chan os.Signal
+
+	copyOutput bool
+
+	scannerBufferInitial int
+	scannerBufferMax     int
+	scannerBufferPool    BufferPool
+	readBufferSize       int
+
+	lines           bool
+	stdoutFunc      func(line []byte)
+	stderrFunc      func(line []byte)
+	keepDelimiter   bool
+	trimCR          bool
+	outputDecoder   Decoder
+	dropInvalidUTF8 bool
+	skipEmptyLines  bool
+	headerLine      bool
+	recentLines     int
+	linePrefix      []byte
+	stderrAsError   bool
+	combinedOutput  bool
+	timestamps      bool
+	stdoutWhole     bool
+	outputFilter    []string
+	stdoutWholeMax  int64
+	fixedChunkSize  int
+
+	path       string
+	env        func() map[string]string
+	colorEnv   map[string]string
+	shell      string
+	loginShell bool
+	dir        string
+
+	extraFiles       []*os.File
+	socketActivation bool
+	listenNames      []string
+
+	allowedExecutables []string
+
+	stderrDebounceWindow time.Duration
+	stderrDebounceMax    int
+
+	stderrCoalesce         bool
+	stderrCoalesceInterval time.Duration
+
+	stdinAudit    io.Writer
+	redactor      func([]byte) []byte
+	stdinPrologue []byte
+	stdinEpilogue []byte
+	stdinRetries  int
+	stdinSource   *os.File
+	stdoutTarget  *os.File
+	stderrTarget  *os.File
+	stdinProgress func(written int64)
+	stdinBackoff  time.Duration
+
+	stdinStallThreshold time.Duration
+	stdinBuffer         int
+	requestDelimiter    []byte
+	stdinSeparator      []byte
+	consumedSentinel    []byte
+
+	heartbeat         []byte
+	heartbeatInterval time.Duration
+
+	context      context.Context
+	stop         <-chan struct{}
+	gracePeriod  time.Duration
+	stopSequence []StopStep
+
+	processGroup bool
+	detach       bool
+	pidFile      string
+	killer       func(target int, signal syscall.Signal) error
+	resetSIGPIPE bool
+	breakPolicy  BreakPolicy
+	reaping      bool
+	startTimeout time.Duration
+
+	parentDeathSignal     syscall.Signal
+	umask                 int
+	hasUmask              bool
+	startupSilenceTimeout time.Duration
+	firstOutput           func(at time.Time, stream Stream, line []byte)
+	clock                 Clock
+}
+
+// DefaultGracePeriod is the grace period used when the process is terminated because its context is done or its stop-channel is closed.
+const DefaultGracePeriod = 5 * time.Second
+
+// WithStdin sets the stdin-channel of the process. Closing the channel closes the stdin-pipe of the process.
+func WithStdin(stdin <-chan []byte) Option {
+	return func(o *options) {
+		o.stdin = stdin
+	}
+}
+
+// WithSignals sets the signals-channel of the process. Signals received on the channel are forwarded to the process. Signals which are in the channel (if it is buffered) or sent before the process has been started are forwarded right after its start.
+func WithSignals(signals <-chan os.Signal) Option {
+	return func(o *options) {
+		o.signals = signals
+	}
+}
+
+// WithCopyOutput controls whether every line delivered on the stdout- and stderr-channels is a fresh copy (the default) or references a buffer which is reused for later lines.
+//
+// Disabling the copy avoids an allocation per line but changes the contract loudly: a line is only valid until the next receive from the same channel. Afterwards its bytes are overwritten by a later line. Only consumers which process each line synchronously and never retain it may disable the copy. To uphold the contract, the stdout- and stderr-channels are unbuffered in this mode.
+//
+// The benchmarks BenchmarkCopyOutput and BenchmarkReferenceOutput compare both modes: without copies the allocations per line vanish, but the synchronous hand-over on the unbuffered channels lowers the throughput. Disable the copy if garbage collection pressure matters more than throughput.
+func WithCopyOutput(copyOutput bool) Option {
+	return func(o *options) {
+		o.copyOutput = copyOutput
+	}
+}
+
+// WithScannerBuffer sets the initial and the maximum size of the buffers used for splitting stdout and stderr into lines. A buffer starts with the initial size and grows as needed up to the maximum size, which limits the length of a line. If a line exceeds the maximum size, reading the corresponding pipe stops and its channel is closed. By default, the buffers start with 4096 bytes and grow up to bufio.MaxScanTokenSize.
+//
+// Process.BufferHighWater reports how much of the buffers has been used.
+func WithScannerBuffer(initial, max int) Option {
+	return func(o *options) {
+		o.scannerBufferInitial = initial
+		o.scannerBufferMax = max
+	}
+}
+
+// WithReadBufferSize reads stdout and stderr through a buffered reader of the given size before splitting them into lines. For processes writing small chunks at a high rate, a larger read buffer can reduce the number of read system calls. It costs size bytes of memory per stream for the lifetime of the pipe, in addition to the scanner buffers of WithScannerBuffer. It does not affect the size of the pipes, which is determined by the operating system.
+func WithReadBufferSize(size int) Option {
+	return func(o *options) {
+		o.readBufferSize = size
+	}
+}
+
+// BufferPool is a pool of scanner buffers, see WithScannerBufferPool. It is satisfied by *sync.Pool.
+type BufferPool interface {
+	Get() any
+	Put(any)
+}
+
+// WithScannerBufferPool takes the initial buffers of the scanners splitting stdout and stderr from the pool and returns them once the corresponding pipe has been read completely. Sharing a pool among processes which are restarted frequently (e.g. by a supervisor) reuses the buffers instead of allocating fresh ones for every start. The pool must hold values of type *[]byte; if it is empty, a buffer of the initial size of WithScannerBuffer is allocated.
+//
+// A buffer is owned by a single scanner from Get to Put, so the scanners of an old and a new process may overlap safely as long as the pool itself is safe for concurrent use, like *sync.Pool. The lines delivered by the process never reference a pooled buffer. A buffer which has to grow beyond its capacity is replaced by the scanner and the grown buffer is not returned to the pool.
+func WithScannerBufferPool(pool BufferPool) Option {
+	return func(o *options) {
+		o.scannerBufferPool = pool
+	}
+}
+
+// WithLines delivers the lines written to stdout and stderr on a single channel returned by Process.Lines instead of the separate stdout- and stderr-channels. Each line carries its stream and a sequence number shared across both streams, which allows reconstructing the interleaving of the streams.
+func WithLines() Option {
+	return func(o *options) {
+		o.lines = true
+	}
+}
+
+// WithContext terminates the process gracefully (see Process.Terminate) when the context is done. If the context is already done, starting the process fails with the error of the context. The grace period is set by WithGracePeriod.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.context = ctx
+	}
+}
+
+// WithStopChannel terminates the process gracefully (see Process.Terminate) when the channel is closed. It is the equivalent of WithContext for code which signals shutdown by closing a plain channel. Both options can be combined; whichever fires first terminates the process. The grace period is set by WithGracePeriod.
+func WithStopChannel(stop <-chan struct{}) Option {
+	return func(o *options) {
+		o.stop = stop
+	}
+}
+
+// WithGracePeriod sets the grace period used when the process is terminated because its context is done or its stop-channel is closed. It defaults to DefaultGracePeriod.
+func WithGracePeriod(gracePeriod time.Duration) Option {
+	return func(o *options) {
+		o.gracePeriod = gracePeriod
+	}
+}
+
+// WithTrimCR strips all trailing carriage returns from the delivered lines. Splitting the output into lines already removes a single carriage return in front of a newline, so lines ending with "\r\n" arrive without it anyway. This option additionally covers output with multiple trailing carriage returns (e.g. "\r\r\n" from tools converting line endings twice) and lines ending with a carriage return only at the end of the output.
+func WithTrimCR() Option {
+	return func(o *options) {
+		o.trimCR = true
+	}
+}
+
+// WithKeepDelimiter controls whether the delivered lines keep their delimiter, i.e. the newline and a carriage return in front of it, for lossless passthrough of the output. By default, the delimiter is stripped. The last line of the output has no delimiter if the output does not end with a newline.
+//
+// The transformations of the other options apply to the line without its newline: with WithTrimCR, a line ending with "\r\n" is delivered ending with "\n", and WithSkipEmptyLines drops lines consisting of the delimiter only.
+func WithKeepDelimiter(keep bool) Option {
+	return func(o *options) {
+		o.keepDelimiter = keep
+	}
+}
+
+// WithHeaderLine delivers the first line of stdout on the one-shot channel returned by Process.Header instead of the stdout-channel (or the callback of WithStdoutFunc or the channel returned by Lines), e.g. the header row of CSV output. The following lines are delivered as usual. Lines dropped by WithSkipEmptyLines do not count as header.
+func WithHeaderLine() Option {
+	return func(o *options) {
+		o.headerLine = true
+	}
+}
+
+// WithRecentLines retains the last n lines of stdout and stderr each in a ring buffer, which are returned by Process.RecentStdout and Process.RecentStderr, e.g. for crash reports. The lines are retained after the transformations of the other options, but regardless of whether they are delivered. Retaining costs a copy of every line.
+func WithRecentLines(n int) Option {
+	return func(o *options) {
+		o.recentLines = n
+	}
+}
+
+// WithLinePrefix prepends the prefix to every line of stdout and stderr delivered to the caller, e.g. a tag for merging the output of several processes into shared logs. It applies to the channels, the callbacks of WithStdoutFunc and WithStderrFunc and the header of WithHeaderLine; on the channel returned by Process.Lines it is part of Line.Data. Lines generated by the package (e.g. summaries of WithStderrDebounce) and the lines retained by WithRecentLines are not prefixed.
+func WithLinePrefix(prefix []byte) Option {
+	return func(o *options) {
+		o.linePrefix = prefix
+	}
+}
+
+// WithStderrAsError treats any output on stderr as failure, e.g. for strict pipelines: if the process exits successfully but wrote to stderr, Process.Wait returns a *StderrError with the last lines of stderr (10 lines or as many as retained by WithRecentLines). To detect the output, Wait waits after the exit of the process until a line of stderr has been read or stderr has been closed. Output which is still being read at this point may be missing from the error. Lines dropped by WithSkipEmptyLines do not count as output.
+func WithStderrAsError() Option {
+	return func(o *options) {
+		o.stderrAsError = true
+	}
+}
+
+// WithCombinedOutput connects both stdout and stderr of the process to a single pipe, like a terminal does, and delivers all lines as stdout: on the stdout-channel, to the callback of WithStdoutFunc or with StreamStdout on the channel returned by Process.Lines. The stderr-channel is nil.
+//
+// Since the kernel serializes the writes of the process to the pipe, the lines arrive in exactly the order they have been written, which two separate pipes read by two goroutines cannot guarantee. The price is that it is lost which stream a line has been written to. Note that programs commonly buffer stdout but not stderr when writing to a pipe, so the writes may happen in a different order than the program produced the output. A separate stderr (WithStderrTarget or WithStderrFunc) is rejected.
+func WithCombinedOutput() Option {
+	return func(o *options) {
+		o.combinedOutput = true
+	}
+}
+
+// WithOutputThrough pipes stdout of the process through a filter process, e.g. []string{"grep", "error"} or []string{"jq", "-c", ".items[]"}, like the shell pipeline "process | filter". The stdout-channel (and all options processing stdout) receives the stdout of the filter instead, while stderr of the filter is delivered with stderr of the process. With WithCombinedOutput, stderr of the process is piped through the filter as well, like "process 2>&1 | filter".
+//
+// The lifetimes of both processes are coupled like in a shell pipeline: the filter joins the process group of the process, so Terminate, Kill and forwarded signals reach both; the filter sees the end of its input once the process exited, and the process receives SIGPIPE when writing after the filter exited. Wait, Done and the exit status belong to the process, but the process is only considered exited once the filter has exited as well. Stdin goes to the process only. The filter is always reaped by the package, also if WithReaping disables reaping of the process.
+func WithOutputThrough(filter []string) Option {
+	return func(o *options) {
+		o.outputFilter = filter
+	}
+}
+
+// WithTimestamps records the time each line has been read from the pipe in Line.At, which is accurate even if the consumer processes the lines late, e.g. for log ingestion. The timestamps are only delivered on the channel returned by Process.Lines, so the option requires WithLines. Taking the time costs a little for every line, so it is opt-in.
+func WithTimestamps() Option {
+	return func(o *options) {
+		o.timestamps = true
+	}
+}
+
+// WithStdoutWhole delivers the whole stdout as a single []byte once the process closed it, instead of splitting it into lines, e.g. for commands like "git rev-parse HEAD" whose output is the value. The data is delivered as written, including all newlines, and the transformations of the other options do not apply. It is delivered even if it is empty. It cannot be combined with WithHeaderLine.
+//
+// With a max greater than 0, at most max bytes are retained: the rest of the output is read and discarded, and an error wrapping ErrOutputTooLarge is reported on the channel returned by Process.Errors. Without a maximum, the memory is not bounded.
+func WithStdoutWhole(max int64) Option {
+	return func(o *options) {
+		o.stdoutWhole = true
+		o.stdoutWholeMax = max
+	}
+}
+
+// WithFixedChunkSize delivers stdout in chunks of exactly size bytes instead of lines, e.g. for fixed-frame transports. Newlines are ordinary bytes within the chunks and the transformations of the other options do not apply. The last chunk is shorter if the output does not end on a chunk boundary; it is delivered once the process closed stdout. The size must not exceed the maximum buffer size of the scanner (see WithScannerBuffer, 64 KiB by default).
+func WithFixedChunkSize(size int) Option {
+	return func(o *options) {
+		o.fixedChunkSize = size
+	}
+}
+
+// WithPath sets the executable of the process independently of the first argument, which is passed to the process as argv[0] unchanged. By default, the executable is looked up from the first argument. This allows launching programs which behave differently depending on argv[0], e.g. busybox applets or login shells:
+//
+//	New([]string{"ls", "-l"}, WithPath("/bin/busybox"))
+//	New([]string{"-bash"}, WithPath("/bin/bash"))
+//
+// A path without path separators is looked up in the directories of the PATH environment variable.
+func WithPath(path string) Option {
+	return func(o *options) {
+		o.path = path
+	}
+}
+
+// WithAllowedExecutables restricts the executables which may be launched to the given absolute paths, as a defense in depth for programs building the arguments from partly untrusted input. New resolves the executable (the first argument or the one given by WithPath) like exec.Command does, via the PATH of the parent, and fails with an error wrapping ErrExecutableNotAllowed unless its absolute path is in the allowlist; the resolved path is launched afterwards, so a later change of PATH has no effect. Symbolic links are not resolved, so an allowed path must be given as it is found. Combined with WithUmask or WithSocketActivation, the shell starting the process passes the resolved path as argv[0] instead of the first argument. The filter of WithOutputThrough and the command of NewFromCmd are checked as well, whereas WithShell is rejected, since the command line passed to the shell can run anything. Without this option, every executable is allowed.
+func WithAllowedExecutables(paths ...string) Option {
+	return func(o *options) {
+		o.allowedExecutables = make([]string, len(paths))
+		for i, path := range paths {
+			o.allowedExecutables[i] = filepath.Clean(path)
+		}
+	}
+}
+
+// WithEnv adds the given variables to the environment inherited from the parent process. Variables with the same name as inherited ones replace them.
+//
+// WithEnv and WithEnvFunc replace each other, the last one given wins.
+func WithEnv(env map[string]string) Option {
+	return WithEnvFunc(func() map[string]string {
+		return env
+	})
+}
+
+// WithForceColor asks the process to colorize its output although stdout and stderr are pipes, by setting the environment variables CLICOLOR_FORCE=1 and FORCE_COLOR=1 which are honored by many tools. Tools which only check whether their output is a terminal are not affected. Variables given by WithEnv or WithEnvFunc take precedence.
+//
+// WithForceColor and WithNoColor replace each other, the last one given wins.
+func WithForceColor() Option {
+	return func(o *options) {
+		o.colorEnv = map[string]string{"CLICOLOR_FORCE": "1", "FORCE_COLOR": "1"}
+	}
+}
+
+// WithNoColor asks the process not to colorize its output by setting the environment variable NO_COLOR=1 (see https://no-color.org). Inherited variables forcing colors are overridden by CLICOLOR_FORCE=0 and FORCE_COLOR=0. Variables given by WithEnv or WithEnvFunc take precedence.
+//
+// WithForceColor and WithNoColor replace each other, the last one given wins.
+func WithNoColor() Option {
+	return func(o *options) {
+		o.colorEnv = map[string]string{"NO_COLOR": "1", "CLICOLOR_FORCE": "0", "FORCE_COLOR": "0"}
+	}
+}
+
+// WithExtraFiles passes the open files to the process as additional file descriptors, starting at 3 like exec.Cmd.ExtraFiles. The files stay owned by the caller, who may close them once the process has been started.
+func WithExtraFiles(files ...*os.File) Option {
+	return func(o *options) {
+		o.extraFiles = files
+	}
+}
+
+// WithSocketActivation passes the extra files of WithExtraFiles (e.g. listening sockets) like systemd does for socket activated services, see sd_listen_fds(3): the file descriptors start at 3, LISTEN_FDS is set to their number and LISTEN_PID to the pid of the process, which tells the process the variables are meant for it. With names, LISTEN_FDNAMES is set to the names of the file descriptors separated by colons, in the order of the files.
+//
+// Since the pid is only known after the fork, the process is started by /bin/sh, which sets LISTEN_PID to its own pid and replaces itself by the process. It works together with WithShell and WithUmask, Start looks up the executable beforehand like for WithUmask (with the same limits). New fails if no extra files are given or WithPath is given, since the shell cannot portably set argv[0] of the process.
+func WithSocketActivation(names ...string) Option {
+	return func(o *options) {
+		o.socketActivation = true
+		o.listenNames = names
+	}
+}
+
+// WithDir sets the working directory of the process. By default, the process runs in the working directory of the parent process.
+func WithDir(dir string) Option {
+	return func(o *options) {
+		o.dir = dir
+	}
+}
+
+// WithEnvFunc is like WithEnv, but the variables are computed by the given function each time the process is started: Start calls it synchronously right before launching the process, not when the option is applied. A process which is restarted (e.g. by a supervisor) therefore picks up a fresh environment, such as rotated secrets, instead of a stale one.
+func WithEnvFunc(env func() map[string]string) Option {
+	return func(o *options) {
+		o.env = env
+	}
+}
+
+// WithStderrCoalesce suppresses consecutive duplicate lines of stderr, like syslog does for a process stuck in a loop. The repeats are summarized by a single line "last message repeated N times" once a different line arrives, when stderr ends and, with an interval greater than 0, at the latest after the interval. The summary is delivered like the one of WithStderrDebounce. Lines are compared after the transformations of the other options, and coalescing takes place before debouncing.
+func WithStderrCoalesce(interval time.Duration) Option {
+	return func(o *options) {
+		o.stderrCoalesce = true
+		o.stderrCoalesceInterval = interval
+	}
+}
+
+// WithStderrDebounce limits the number of stderr lines delivered per time window to max, protecting downstream log systems from a runaway process. Excess lines are dropped and summarized by a single line "N lines suppressed" at the end of the window. On the stderr-channel the summary is prefixed with SummaryPrefix, on the channel returned by Process.Lines it is delivered with StreamSummary, so it is not mistaken for output of the process.
+func WithStderrDebounce(window time.Duration, max int) Option {
+	return func(o *options) {
+		o.stderrDebounceWindow = window
+		o.stderrDebounceMax = max
+	}
+}
+
+// WithStdinAudit writes everything sent to the stdin of the process, including the appended newlines, to the given writer as well. It provides an audit trail of the input of the process. Errors of the writer are ignored and do not affect the stdin of the process. The writer is only used by a single goroutine.
+func WithStdinAudit(w io.Writer) Option {
+	return func(o *options) {
+		o.stdinAudit = w
+	}
+}
+
+// WithRedactor sets a function which masks sensitive data (e.g. tokens, passwords) before it is written to a sink like the audit writer of WithStdinAudit or the tee of Process.SetStdoutTee. The process and the channels of the caller always receive the unredacted data. The function receives a copy of the data and returns the redacted data.
+func WithRedactor(redactor func([]byte) []byte) Option {
+	return func(o *options) {
+		o.redactor = redactor
+	}
+}
+
+// WithStopSequence replaces the escalation from SIGTERM to SIGKILL of Process.Terminate by the sequence of steps, e.g. for services which expect a specific choreography like SIGTERM, SIGTERM again after 5 seconds and SIGKILL after another 5 seconds:
+//
+//	WithStopSequence([]StopStep{
+//		{Signal: syscall.SIGTERM},
+//		{WaitBefore: 5 * time.Second, Signal: syscall.SIGTERM},
+//		{WaitBefore: 5 * time.Second, Signal: syscall.SIGKILL},
+//	})
+//
+// Each step waits for the exit of the process before sending its signal, and the sequence ends early once the process exited. The sequence applies to every graceful stop, including the stop conditions of WithContext and WithStopChannel, which ignore the grace period then. Since Terminate returns only after the exit of the process, the sequence should end with SIGKILL.
+func WithStopSequence(steps []StopStep) Option {
+	return func(o *options) {
+		o.stopSequence = steps
+	}
+}
+
+// WithProcessGroup controls whether the process is started in a process group of its own (the default). Signals, Terminate and Kill address the whole process group, which reaches the descendants of the process as well. Without a process group, they address the process only and descendants may be orphaned; KillTree reaches them anyway.
+func WithProcessGroup(processGroup bool) Option {
+	return func(o *options) {
+		o.processGroup = processGroup
+	}
+}
+
+// WithStdinPrologue writes the given bytes to the stdin of the process immediately after the start, before any message of the stdin-channel. It suits handshake protocols requiring a greeting first without racing the first message of the caller. The bytes are written as they are, no newline is appended.
+func WithStdinPrologue(prologue []byte) Option {
+	return func(o *options) {
+		o.stdinPrologue = prologue
+	}
+}
+
+// WithStdinEpilogue writes the given bytes to the stdin of the process after the stdin-channel has been closed, right before the stdin-pipe is closed. The bytes are written as they are, no newline is appended.
+func WithStdinEpilogue(epilogue []byte) Option {
+	return func(o *options) {
+		o.stdinEpilogue = epilogue
+	}
+}
+
+// WithOutputEncoding transcodes every line of stdout and stderr from the encoding of the decoder to UTF-8 before delivery. It allows consuming output of legacy tools emitting e.g. Latin-1 in pipelines expecting UTF-8, like JSON or logging. Lines which cannot be transcoded are delivered unchanged. Since transcoding has a cost, it is opt-in.
+func WithOutputEncoding(decoder Decoder) Option {
+	return func(o *options) {
+		o.outputDecoder = decoder
+	}
+}
+
+// WithDropInvalidUTF8 drops invalid UTF-8 sequences from every line of stdout and stderr before delivery (after transcoding, if WithOutputEncoding is given).
+func WithDropInvalidUTF8() Option {
+	return func(o *options) {
+		o.dropInvalidUTF8 = true
+	}
+}
+
+// WithDetach starts the process detached from the parent, e.g. for a daemon which outlives the parent: the process becomes the leader of a new session (Setsid), so it has no controlling terminal and does not receive its hangup, and its standard streams which are not connected to files (see WithStdinSource, WithStdoutTarget and WithStderrTarget) are connected to the null device instead of pipes, which would break once the parent exits.
+//
+// The channel interface is therefore largely moot: the stdin-, stdout- and stderr-channels are nil, and a stdin-channel or output callbacks are rejected. The process can be managed later by its pid (see Process.Pid and WithPidFile). While the parent runs, the process is still reaped by the package and Terminate, Kill and the stop conditions work as usual; the package does not kill it when the parent exits.
+func WithDetach() Option {
+	return func(o *options) {
+		o.detach = true
+	}
+}
+
+// WithParentDeathSignal asks the kernel to send the signal (e.g. SIGKILL) to the process when the parent dies, so that the process does not outlive a crashing parent. It is only supported on Linux (prctl PR_SET_PDEATHSIG), on other platforms Start fails with ErrNotSupported.
+//
+// Caveat: the signal is tied to the thread which started the process, not to the parent process as a whole. The Go runtime starts processes from arbitrary threads and a thread may exit while the parent keeps running, e.g. when a goroutine which called runtime.LockOSThread returns without unlocking, in which case the process is signaled early. The signal is cleared when the process executes a set-user-ID or set-group-ID program.
+func WithParentDeathSignal(signal syscall.Signal) Option {
+	return func(o *options) {
+		o.parentDeathSignal = signal
+	}
+}
+
+// WithUmask sets the file mode creation mask of the process (e.g. 0o077), so that the permissions of the files it creates do not depend on the umask of the parent. The mask must be within 0 and 0o777.
+//
+// The umask is a per-process attribute which has to be set after the fork and before the exec, but Go provides no way to run code in between and changing the umask of the parent around the start would affect all of its goroutines. Therefore the process is started by /bin/sh, which sets the umask and replaces itself by the process, keeping the pid. This is only supported on Unix platforms.
+//
+// Start looks up the executable beforehand, so that a missing or non-executable file still fails with ErrNotFound or ErrPermission; the shell itself only reports the failure by its exit status. A file in a format the system cannot execute is not detected: instead of failing with ErrExecFormat, it is run as a script by the shell or makes it exit with status 126. Since the shell cannot portably set argv[0] of the process, WithUmask cannot be combined with WithPath.
+func WithUmask(mask int) Option {
+	return func(o *options) {
+		o.umask = mask
+		o.hasUmask = true
+	}
+}
+
+// WithPidFile writes the pid of the process followed by a newline to the file at the path once the process has been started, e.g. for managing a detached process later (see WithDetach). The file is not removed when the process exits. A failure to write the file does not stop the process but is reported on the channel returned by Process.Errors.
+func WithPidFile(path string) Option {
+	return func(o *options) {
+		o.pidFile = path
+	}
+}
+
+// WithKiller replaces the mechanism sending signals to the process, which is syscall.Kill by default, e.g. for containers or PID namespaces where the signals have to be delivered by a cgroup freezer or a container runtime API instead. It is used for all signals sent by the package: forwarded signals, Terminate, Kill and KillTree.
+//
+// The target follows the convention of kill(2): a negative target addresses the process group -target (see WithProcessGroup), a positive one a single process. The killer has to return syscall.ESRCH if the target does not exist anymore, which is not treated as an error.
+func WithKiller(killer func(target int, signal syscall.Signal) error) Option {
+	return func(o *options) {
+		o.killer = killer
+	}
+}
+
+// WithResetSIGPIPE starts the process with the default disposition of SIGPIPE, so that it is killed by SIGPIPE when writing to a pipe whose reader has gone away, like in a shell pipeline (e.g. a producer piped into head). This matters for classic Unix filters which rely on SIGPIPE instead of checking for EPIPE.
+//
+// Usually a process started by a Go program already gets the default disposition, since the Go runtime handles SIGPIPE and exec resets handled signals. However, if SIGPIPE is ignored in the parent (by signal.Ignore or because the parent itself has been started with SIGPIPE ignored, e.g. by nohup), the process inherits the ignored disposition and gets EPIPE instead. Because Go offers no hook between fork and exec, the option handles SIGPIPE in the parent while the process is being started and restores the previous disposition afterwards. Concurrent changes of the SIGPIPE disposition by other code during a start may be lost. The option is supported on Unix platforms only.
+func WithResetSIGPIPE() Option {
+	return func(o *options) {
+		o.resetSIGPIPE = true
+	}
+}
+
+// WithBreakPolicy sets what happens when the consumer breaks out of a loop over Process.StdoutSeq or Process.StderrSeq. It defaults to BreakDrain. The grace period of BreakTerminate is set by WithGracePeriod.
+func WithBreakPolicy(policy BreakPolicy) Option {
+	return func(o *options) {
+		o.breakPolicy = policy
+	}
+}
+
+// WithReaping controls whether the package waits for the process to reap it when it exits (the default). Disabling it delegates reaping to the caller, e.g. to an init process or a supervision framework which already reaps all children and would conflict with the package.
+//
+// Without reaping, the exit of the process is detected by the end of its output instead: Process.Done is closed once the stdout- and stderr-channels have been closed, i.e. after all output has been consumed. Process.Wait returns nil and Process.ProcessState stays nil. Beware: if nobody else reaps the process, it remains a zombie after its exit.
+//
+// With reaping, every process is reaped by waiting for its own pid (wait4), independently of other processes, so any number of processes (e.g. of several supervisors) can be managed concurrently without leaving zombies behind. The package does not install a handler for SIGCHLD and never reaps processes it did not start, so it does not conflict with reaping done by the host application for its own children, as long as the application does not wait for any child (e.g. wait4(-1)) and thereby steal the exit status of a process of the package.
+func WithReaping(reaping bool) Option {
+	return func(o *options) {
+		o.reaping = reaping
+	}
+}
+
+// WithStdoutFunc calls the given function for every line written by the process to its stdout instead of delivering it on the stdout-channel, which is not created then. It is the push-based counterpart of the channel and suits e.g. logging. The function is called by the goroutine reading the pipe: it must not block for long, since the process blocks as soon as the pipe is full. The calls are never concurrent. The function takes precedence over WithLines for stdout.
+func WithStdoutFunc(f func(line []byte)) Option {
+	return func(o *options) {
+		o.stdoutFunc = f
+	}
+}
+
+// WithStderrFunc calls the given function for every line written by the process to its stderr instead of delivering it on the stderr-channel. See WithStdoutFunc.
+func WithStderrFunc(f func(line []byte)) Option {
+	return func(o *options) {
+		o.stderrFunc = f
+	}
+}
+
+// WithStartTimeout bounds the time starting the process may take. Starting a process rarely hangs, but fork and exec can stall under memory pressure or on unresponsive file systems. If the start does not complete in time, Process.Start returns an error wrapping ErrStartTimeout which includes the timeout. A process which starts after the timeout nevertheless is killed and reaped in the background.
+func WithStartTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.startTimeout = timeout
+	}
+}
+
+// WithSkipEmptyLines controls whether empty lines of stdout and stderr are dropped instead of being delivered. By default they are delivered for fidelity. Lines are checked after all transformations, so with WithTrimCR a line consisting of carriage returns only is empty and dropped as well.
+func WithSkipEmptyLines(skip bool) Option {
+	return func(o *options) {
+		o.skipEmptyLines = skip
+	}
+}
+
+// WithShell runs the process by the given shell (e.g. "/bin/bash", "/bin/sh" if empty) instead of executing it directly. With login, the shell is a login shell (-l) which sources the profile scripts first, so the process sees the PATH and environment configured there. This changes the semantics significantly and is therefore opt-in.
+//
+// The arguments are quoted in single quotes, a single quote within an argument ends the quoting, is escaped and the quoting resumes:
+//
+//	[]string{"echo", "it's $HOME"}  ->  exec 'echo' 'it'\''s $HOME'
+//
+// So the shell passes them literally: there is no expansion of variables, globs or other shell syntax in the arguments, and arguments cannot inject commands. The shell replaces itself by the process via exec, so signals reach the process directly. WithPath has no effect in combination with WithShell.
+//
+// Security: the shell, and even more the profile scripts sourced by a login shell, run arbitrary code of the user environment before the process starts. Only use it where this environment is trusted. Code which needs shell syntax should not rely on this option but pass an explicit script to a shell, e.g. []string{"sh", "-c", script}, and must never interpolate untrusted input into that script.
+func WithShell(shell string, login bool) Option {
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	return func(o *options) {
+		o.shell = shell
+		o.loginShell = login
+	}
+}
+
+// WithStdinRetry retries a write of a message of the stdin-channel up to attempts times if it fails transiently (EAGAIN or EINTR), waiting backoff before the first retry and doubling the wait for each further retry. Other errors like EPIPE (the process closed its stdin) are not retried. A write which finally fails is reported on the channel returned by Process.Errors.
+func WithStdinRetry(attempts int, backoff time.Duration) Option {
+	return func(o *options) {
+		o.stdinRetries = attempts
+		o.stdinBackoff = backoff
+	}
+}
+
+// WithStdinProgress calls the function with the number of bytes written to the stdin-pipe so far, e.g. for a progress bar while piping large data into the process. It is called by the goroutine writing stdin after a write, but at most every 100 milliseconds, and once more with the final total when the stdin-pipe is closed because the stdin-channel has been closed. The function must not block, since it delays the writes.
+func WithStdinProgress(progress func(written int64)) Option {
+	return func(o *options) {
+		o.stdinProgress = progress
+	}
+}
+
+// WithStdinSource connects the stdin of the process directly to the file (e.g. an open file or socket) instead of a pipe fed by the stdin-channel. The stdin-channel returned by Process.Stdin is nil, and WriteLine returns ErrStdinClosed. It cannot be combined with WithStdin. The file is not closed by the package.
+func WithStdinSource(file *os.File) Option {
+	return func(o *options) {
+		o.stdinSource = file
+	}
+}
+
+// WithStdoutTarget connects the stdout of the process directly to the file (e.g. a log file or socket), so the process writes to it without any copying by the parent. The stdout-channel returned by Process.Stdout is nil and the lines of stdout are neither split nor transformed. It cannot be combined with WithStdoutFunc. The file is not closed by the package.
+func WithStdoutTarget(file *os.File) Option {
+	return func(o *options) {
+		o.stdoutTarget = file
+	}
+}
+
+// WithStderrTarget is like WithStdoutTarget for stderr.
+func WithStderrTarget(file *os.File) Option {
+	return func(o *options) {
+		o.stderrTarget = file
+	}
+}
+
+// WithStdinSeparator writes the separator between consecutive messages on stdin instead of a newline after every message, e.g. for formats where a trailing delimiter is significant or forbidden. Since the separator is written before every message except the first, no message has to be recognized as the last one: the last message is simply the one before the stdin-channel is closed, and nothing follows it but the epilogue of WithStdinEpilogue. The framing applies to all messages, including those of WriteLine and WithStdinHeartbeat.
+func WithStdinSeparator(separator []byte) Option {
+	return func(o *options) {
+		o.stdinSeparator = separator
+	}
+}
+
+// WithConsumedSentinel sets a line the process writes to stdout once it processed all of its input, e.g. "done" printed by a batch program after the end of its input. Process.WaitStdinConsumed returns when the sentinel has been read, without waiting for the process to close its output. The sentinel is compared without the line delimiter and is delivered like any other line.
+func WithConsumedSentinel(sentinel []byte) Option {
+	return func(o *options) {
+		o.consumedSentinel = sentinel
+	}
+}
+
+// WithRequestDelimiter sets the line written by Process.EndRequest to mark the end of a request on stdin, e.g. an empty line or "---", for processes which read one request after another from the same stdin.
+//
+// A real end of file cannot be used for this: once the stdin-pipe has been closed, it cannot be reopened, and the process sees the end of its input for good. Programs which read their input until the end of file (e.g. cat, sort, wc or jq) therefore process a single request per run and have to be restarted for the next one. Only programs with a protocol of explicit boundaries can handle several requests over one pipe, e.g. line-based REPLs and servers, jq --seq (records separated by the RS character) or programs reading NUL-terminated input; the delimiter must match the one the program expects. Sending Ctrl-D (EOT) does not help either, since it only ends the input on a terminal, whereas on a pipe it is an ordinary byte.
+func WithRequestDelimiter(delimiter []byte) Option {
+	return func(o *options) {
+		o.requestDelimiter = delimiter
+	}
+}
+
+// WithStdinBuffer buffers the stdin-channel owned by the process (see Process.Stdin) with the given capacity, so that a producer can enqueue a batch of messages without waiting for each of them to be picked up. By default, the channel is unbuffered; a negative capacity is rejected by New. It has no effect on a stdin-channel provided via WithStdin, whose capacity is chosen by the caller.
+//
+// Closing the channel does not discard buffered messages: they are written to the stdin-pipe before it is closed, and Process.StdinDone is closed afterwards. Buffered messages are dropped if the stdin-pipe has been closed before, which Process.Kill, Process.KillTree and a Process.WriteLineContext aborted by its context do. The exit of the process does not close the stdin-pipe: the buffered messages are still taken from the channel, but their writes fail once the process is gone (see StdinTruncatedError).
+func WithStdinBuffer(capacity int) Option {
+	return func(o *options) {
+		o.stdinBuffer = capacity
+	}
+}
+
+// WithStdinStallWarn reports an error wrapping ErrStdinStalled on the channel returned by Process.Errors when a write to the stdin-pipe is pending longer than the threshold, i.e. the process does not read its stdin and the pipe is full. The error is reported once per stalled write and the write continues, so the caller can react (e.g. alert, slow down the producer or kill the process) before the process is given up.
+func WithStdinStallWarn(threshold time.Duration) Option {
+	return func(o *options) {
+		o.stdinStallThreshold = threshold
+	}
+}
+
+// WithStdinHeartbeat writes the message followed by a newline to the stdin of the process every interval, e.g. as a keepalive of a protocol. Heartbeats are written by the same goroutine as the messages of the stdin-channel and WriteLine, so they never split a message. The heartbeat stops when the process exits or the stdin-channel is closed.
+func WithStdinHeartbeat(msg []byte, interval time.Duration) Option {
+	return func(o *options) {
+		o.heartbeat = msg
+		o.heartbeatInterval = interval
+	}
+}
+
+// WithClock sets the clock of the timers of the process: the grace period and the stop sequence of Terminate, the start timeout of WithStartTimeout and the timeout of WithStartupSilenceTimeout. By default, the clock of the time package is used. Other timers, e.g. of WithStderrDebounce or WithStdinHeartbeat, always use real time.
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithFirstOutput calls the function once with the first line read from stdout or stderr, e.g. to measure the time to first output of the process. The line is passed as read, before the transformations of the other options and even if it is dropped by them. The function is called exactly once if the process writes any output, even if stdout and stderr are written concurrently, and never otherwise. It runs on the goroutine reading the stream, which does not continue before the function returned.
+func WithFirstOutput(f func(at time.Time, stream Stream, line []byte)) Option {
+	return func(o *options) {
+		o.firstOutput = f
+	}
+}
+
+// WithStartupSilenceTimeout terminates the process gracefully (see WithGracePeriod) if it does not write a single line to stdout or stderr within the timeout after its start, e.g. for daemons which print a "ready" line quickly and hang silently when misconfigured. The timeout is armed once at the start and disarmed by the first line, later silence is not limited.
+//
+// The failed startup is reported by Process.StartupFailed and by an error wrapping ErrStartupSilence on the channel returned by Process.Errors, which tells it apart from other stops.
+func WithStartupSilenceTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.startupSilenceTimeout = timeout
+	}
+}
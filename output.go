@@ -0,0 +1,559 @@
+package goprocess
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stream identifies an output stream of a process.
+type Stream int
+
+const (
+	// StreamStdout identifies the stdout of a process.
+	StreamStdout Stream = iota + 1
+	// StreamStderr identifies the stderr of a process.
+	StreamStderr
+	// StreamSummary identifies lines generated by the package which summarize output of the process, e.g. suppressed lines.
+	StreamSummary
+)
+
+// SummaryPrefix is the prefix of lines generated by the package which are delivered on the stdout- or stderr-channel, e.g. summaries of suppressed lines. On the channel returned by Process.Lines, such lines are delivered with StreamSummary instead.
+const SummaryPrefix = "goprocess: "
+
+// String returns the name of the stream.
+func (s Stream) String() string {
+	switch s {
+	case StreamStdout:
+		return "stdout"
+	case StreamStderr:
+		return "stderr"
+	case StreamSummary:
+		return "summary"
+	}
+	return "unknown"
+}
+
+// Line is a line written by a process, delivered on the channel returned by Process.Lines.
+type Line struct {
+	// Seq is the sequence number of the line. The sequence is shared across stdout and stderr and numbers the lines in the order they have been read, starting at 1. Since the streams are read concurrently, the order of lines from different streams is only as accurate as the goroutine scheduling allows.
+	Seq uint64
+	// Stream is the stream the line has been written to.
+	Stream Stream
+	// Data is the line without the newline.
+	Data []byte
+	// At is the time the line has been read from the pipe, if WithTimestamps is given. It carries the wall clock for ingestion as well as the monotonic clock for measuring intervals between lines. It is the zero time otherwise.
+	At time.Time
+}
+
+// DetachOutput stops delivering the output of the process, e.g. once the caller found what it was looking for, while the process keeps running: stdout and stderr are still read, so the process is not blocked by full pipes, but the lines are discarded instead of being delivered to the channels or callbacks. Lines buffered in the channels remain receivable, and the channels are closed as usual once the process closed its pipes. Features which do not deliver lines, like WithRecentLines or WithStderrAsError, are not affected. Stopping the process is left to the caller. DetachOutput may be called multiple times.
+func (p *Process) DetachOutput() {
+	p.discardOnce.Do(func() {
+		close(p.discard)
+	})
+}
+
+// StdoutPending returns the number of lines buffered in the stdout-channel which have not been received yet, e.g. to slow down producers or scale consumers before the buffer fills up (its capacity is cap(p.Stdout())). The result is an instantaneous snapshot which may be outdated by the time it is used, since the process and the consumers keep going concurrently. It returns 0 if there is no stdout-channel.
+func (p *Process) StdoutPending() int {
+	return len(p.stdout.lines)
+}
+
+// StderrPending returns the number of lines buffered in the stderr-channel which have not been received yet. See StdoutPending.
+func (p *Process) StderrPending() int {
+	return len(p.stderr.lines)
+}
+
+// RecvStdout receives the next line from the stdout-channel. It returns the line and true, or false if the channel has been closed, or the error of the context if it is done before a line arrives. It is meant for a single consumer; concurrent callers (as well as other receivers of the channel) race for the lines. The stdout-channel is not available if WithLines is given, in which case RecvStdout only returns once the context is done.
+func (p *Process) RecvStdout(ctx context.Context) ([]byte, bool, error) {
+	return recv(ctx, p.stdout.lines)
+}
+
+// RecvStderr receives the next line from the stderr-channel. See RecvStdout for the semantics.
+func (p *Process) RecvStderr(ctx context.Context) ([]byte, bool, error) {
+	return recv(ctx, p.stderr.lines)
+}
+
+func recv(ctx context.Context, lines <-chan []byte) ([]byte, bool, error) {
+	select {
+	case line, ok := <-lines:
+		return line, ok, nil
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
+
+// output is the state of an output stream of a process.
+type output struct {
+	stream Stream
+	// lines is the channel of the stream, it is nil if the lines are delivered on the merged channel
+	lines chan []byte
+	// callback is called for every line instead of delivering it on a channel, it is nil if the lines are delivered on a channel
+	callback  func(line []byte)
+	highWater atomic.Int64
+	// longestLine, growths and scanned are the statistics of the scanner, see Process.Stats
+	longestLine atomic.Int64
+	growths     atomic.Int64
+	scanned     atomic.Int64
+	// discard is closed once the lines are discarded instead of delivered, see Process.DetachOutput
+	discard <-chan struct{}
+	// stalls and stalled are the number of sends blocked by a full channel and the total time blocked
+	stalls  atomic.Int64
+	stalled atomic.Int64
+	// debounce limits the delivered lines, it is nil if the lines are not limited
+	debounce *debouncer
+	// coalesce suppresses repeated lines, it is nil if repeated lines are delivered
+	coalesce *coalescer
+	// recent retains the last lines of the stream, it is nil if WithRecentLines is not given
+	recent *ring
+	// written is closed once a line has been read or the stream has ended, it is nil if not needed
+	written     chan struct{}
+	writtenOnce sync.Once
+	// hasLines is whether a line has been read
+	hasLines atomic.Bool
+	// tee receives a copy of the lines, it is nil if no tee is set, see Process.SetStdoutTee
+	tee      io.Writer
+	teeMutex sync.Mutex
+	// header receives the first line instead of the channel of the stream, it is nil if there is no header or it has been delivered
+	header chan []byte
+}
+
+func (p *Process) recv(o *output, reader io.ReadCloser) {
+	if o.stream == StreamStdout && p.options.stdoutWhole {
+		go p.recvWhole(o, reader)
+		return
+	}
+	go func() {
+		defer reader.Close()
+		var input io.Reader = reader
+		if p.options.readBufferSize > 0 {
+			input = bufio.NewReaderSize(reader, p.options.readBufferSize)
+		}
+		buffer := p.scannerBuffer()
+		scanner := p.newScanner(&countingReader{reader: input, count: &o.scanned}, buffer, o)
+		var buffers lineBuffers
+		// prefixed is the buffer for prefixing the lines, reused for every line
+		var prefixed []byte
+		chunked := o.chunked(p)
+		for scanner.Scan() {
+			at := p.readTime()
+			p.firstOutputOnce.Do(func() {
+				p.reportFirstOutput(o.stream, scanner.Bytes())
+			})
+			line := scanner.Bytes()
+			if !chunked {
+				line = p.transform(line)
+			}
+			if o.stream == StreamStdout && p.options.consumedSentinel != nil && bytes.Equal(stripDelimiter(line), p.options.consumedSentinel) {
+				p.sentinelReadOnce.Do(func() {
+					close(p.sentinelRead)
+				})
+			}
+			if p.options.skipEmptyLines && !chunked && len(stripDelimiter(line)) == 0 {
+				continue
+			}
+			if o.recent != nil {
+				o.recent.add(line)
+			}
+			if o.written != nil && !o.hasLines.Load() {
+				o.hasLines.Store(true)
+				o.closeWritten()
+			}
+			if o.coalesce != nil && !o.coalesce.allow(line) {
+				continue
+			}
+			if o.debounce != nil && !o.debounce.allow() {
+				continue
+			}
+			if p.options.linePrefix != nil && !chunked {
+				prefixed = append(append(prefixed[:0], p.options.linePrefix...), line...)
+				line = prefixed
+			}
+			if o.header != nil {
+				p.writeTee(o, line)
+				o.header <- append([]byte(nil), line...)
+				close(o.header)
+				o.header = nil
+				continue
+			}
+			p.deliver(o, p.own(&buffers, line), at)
+		}
+		if o.header != nil {
+			// no header has been written
+			close(o.header)
+		}
+		if o.written != nil {
+			o.closeWritten()
+		}
+		p.releaseScannerBuffer(buffer)
+		if o.coalesce != nil {
+			o.coalesce.close()
+		}
+		if o.debounce != nil {
+			o.debounce.close()
+		}
+		p.closeOutput(o)
+	}()
+}
+
+// RecentStdout returns the last n lines the process wrote to stdout (at most as many as retained by WithRecentLines), oldest first, e.g. for a diagnostic snapshot. The lines are copies and include lines which have not been received yet or have been suppressed. It returns nil if WithRecentLines is not given (RecentStderr also retains lines if WithStderrAsError is given). It is safe to call at any time, also concurrently.
+func (p *Process) RecentStdout(n int) [][]byte {
+	return p.stdout.recentLines(n)
+}
+
+// RecentStderr returns the last n lines the process wrote to stderr. See RecentStdout.
+func (p *Process) RecentStderr(n int) [][]byte {
+	return p.stderr.recentLines(n)
+}
+
+func (o *output) recentLines(n int) [][]byte {
+	if o.recent == nil {
+		return nil
+	}
+	return o.recent.last(n)
+}
+
+// reportFirstOutput records the first line of the process and passes it to the callback of WithFirstOutput. It is called once by firstOutputOnce.
+func (p *Process) reportFirstOutput(stream Stream, line []byte) {
+	at := time.Now()
+	close(p.firstOutput)
+	if p.options.firstOutput != nil {
+		p.options.firstOutput(at, stream, append([]byte(nil), line...))
+	}
+}
+
+// recvWhole reads the output until the end and delivers it as a single line, see WithStdoutWhole.
+func (p *Process) recvWhole(o *output, reader io.ReadCloser) {
+	defer reader.Close()
+	max := p.options.stdoutWholeMax
+	var data []byte
+	var err error
+	if max > 0 {
+		data, err = io.ReadAll(io.LimitReader(reader, max+1))
+		if int64(len(data)) > max {
+			data = data[:max]
+			p.reportError(fmt.Errorf("%w: stdout exceeds %d bytes", ErrOutputTooLarge, max))
+			// keep reading, so that the process is not blocked by the full pipe
+			io.Copy(io.Discard, reader)
+		}
+	} else {
+		data, err = io.ReadAll(reader)
+	}
+	if err != nil {
+		p.reportError(err)
+	}
+	if len(data) > 0 {
+		p.firstOutputOnce.Do(func() {
+			p.reportFirstOutput(o.stream, data)
+		})
+	}
+	p.deliver(o, data, p.readTime())
+	p.closeOutput(o)
+}
+
+func (o *output) closeWritten() {
+	o.writtenOnce.Do(func() {
+		close(o.written)
+	})
+}
+
+// readTime returns the current time if timestamps are delivered (see WithTimestamps), the zero time otherwise.
+func (p *Process) readTime() time.Time {
+	if !p.options.timestamps || p.output == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// deliver passes a line to the callback of the stream or sends it to the channel of the stream or the merged channel, and writes it to the tee. The time the line has been read is only delivered on the merged channel.
+func (p *Process) deliver(o *output, line []byte, at time.Time) {
+	p.writeTee(o, line)
+	if o.discarding() {
+		return
+	}
+	if o.callback != nil {
+		o.callback(line)
+		return
+	}
+	if p.output != nil {
+		send(o, p.output, Line{Seq: p.sequence.Add(1), Stream: o.stream, Data: line, At: at})
+		return
+	}
+	send(o, o.lines, line)
+}
+
+// scanStats returns the statistics recorded by the scanner.
+func (o *output) scanStats() ScanStats {
+	return ScanStats{LongestLine: int(o.longestLine.Load()), BufferGrowths: int(o.growths.Load()), Bytes: o.scanned.Load()}
+}
+
+// stallsSoFar returns the stalls recorded by send.
+func (o *output) stallsSoFar() Stalls {
+	return Stalls{Count: o.stalls.Load(), Duration: time.Duration(o.stalled.Load())}
+}
+
+// discarding returns whether the lines are discarded instead of delivered.
+func (o *output) discarding() bool {
+	select {
+	case <-o.discard:
+		return true
+	default:
+		return false
+	}
+}
+
+// send sends the value on the channel. If the channel is full, it records the time blocked until the value has been received as a stall of the stream. The value is dropped if the lines are discarded meanwhile.
+func send[T any](o *output, c chan<- T, value T) {
+	select {
+	case c <- value:
+		return
+	default:
+	}
+	start := time.Now()
+	select {
+	case c <- value:
+	case <-o.discard:
+	}
+	o.stalls.Add(1)
+	o.stalled.Add(int64(time.Since(start)))
+}
+
+// deliverSummary passes a line generated by the package to the callback of the stream or sends it to the channel of the stream or the merged channel.
+func (p *Process) deliverSummary(o *output, summary string) {
+	if o.discarding() {
+		return
+	}
+	if o.callback != nil {
+		o.callback([]byte(SummaryPrefix + summary))
+		return
+	}
+	if p.output != nil {
+		send(o, p.output, Line{Seq: p.sequence.Add(1), Stream: StreamSummary, Data: []byte(summary), At: p.readTime()})
+		return
+	}
+	send(o, o.lines, []byte(SummaryPrefix+summary))
+}
+
+// closeOutput closes the channel of the stream. The merged channel and the outputs-closed channel are closed after all streams read from pipes have been closed.
+func (p *Process) closeOutput(o *output) {
+	if o.lines != nil {
+		close(o.lines)
+	}
+	if p.openOutputs.Add(-1) == 0 {
+		p.closeOutputs()
+	}
+}
+
+// closeOutputs closes the merged channel and the outputs-closed channel.
+func (p *Process) closeOutputs() {
+	if p.output != nil {
+		close(p.output)
+	}
+	close(p.outputsClosed)
+}
+
+// newScanner creates a scanner splitting the output into lines. It records the largest amount of data the scanner had to buffer, the longest line and the growths of its buffer in the statistics of the output.
+func (p *Process) newScanner(reader io.Reader, buffer *[]byte, o *output) *bufio.Scanner {
+	scanner := bufio.NewScanner(reader)
+	if buffer != nil {
+		max := p.options.scannerBufferMax
+		if max <= 0 {
+			max = bufio.MaxScanTokenSize
+		}
+		scanner.Buffer(*buffer, max)
+	}
+	// bufferSize is the size of the buffer of the scanner as far as it has been observed: the data passed to the split function is a slice of the buffer, whose capacity only increases when the scanner replaced the buffer by a larger one
+	var bufferSize int
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if n := int64(len(data)); n > o.highWater.Load() {
+			o.highWater.Store(n)
+		}
+		if cap(data) > bufferSize {
+			if bufferSize > 0 {
+				o.growths.Add(1)
+			}
+			bufferSize = cap(data)
+		}
+		split := bufio.ScanLines
+		if o.chunked(p) {
+			split = scanFixedChunks(p.options.fixedChunkSize)
+		} else if p.options.keepDelimiter {
+			split = scanLinesWithDelimiter
+		}
+		advance, token, err := split(data, atEOF)
+		if n := int64(len(token)); n > o.longestLine.Load() {
+			o.longestLine.Store(n)
+		}
+		return advance, token, err
+	})
+	return scanner
+}
+
+// chunked returns whether the output is split into chunks of a fixed size instead of lines, see WithFixedChunkSize.
+func (o *output) chunked(p *Process) bool {
+	return o.stream == StreamStdout && p.options.fixedChunkSize > 0
+}
+
+// scanFixedChunks returns a split function splitting the data into chunks of the size. The last chunk is shorter if the data does not end on a chunk boundary.
+func scanFixedChunks(size int) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if len(data) >= size {
+			return size, data[:size], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// countingReader counts the bytes read.
+type countingReader struct {
+	reader io.Reader
+	count  *atomic.Int64
+}
+
+func (r *countingReader) Read(data []byte) (int, error) {
+	n, err := r.reader.Read(data)
+	r.count.Add(int64(n))
+	return n, err
+}
+
+// scannerBuffer returns the initial buffer of a scanner, taken from the pool given by WithScannerBufferPool. It returns nil if the scanner allocates its default buffer itself.
+func (p *Process) scannerBuffer() *[]byte {
+	if buffer, ok := p.getPooledBuffer(); ok {
+		return buffer
+	}
+	if p.options.scannerBufferPool == nil && p.options.scannerBufferMax <= 0 {
+		return nil
+	}
+	initial := p.options.scannerBufferInitial
+	if initial <= 0 {
+		initial = 4096
+	}
+	buffer := make([]byte, 0, initial)
+	return &buffer
+}
+
+// getPooledBuffer takes a buffer from the pool given by WithScannerBufferPool.
+func (p *Process) getPooledBuffer() (*[]byte, bool) {
+	if p.options.scannerBufferPool == nil {
+		return nil, false
+	}
+	buffer, ok := p.options.scannerBufferPool.Get().(*[]byte)
+	return buffer, ok && buffer != nil
+}
+
+// releaseScannerBuffer returns the initial buffer of a finished scanner to the pool given by WithScannerBufferPool.
+func (p *Process) releaseScannerBuffer(buffer *[]byte) {
+	if p.options.scannerBufferPool == nil || buffer == nil {
+		return
+	}
+	*buffer = (*buffer)[:0]
+	p.options.scannerBufferPool.Put(buffer)
+}
+
+// scanLinesWithDelimiter is like bufio.ScanLines, but the lines keep their delimiter (the newline and a carriage return preceding it). The last line keeps no delimiter if the output does not end with a newline.
+func scanLinesWithDelimiter(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i+1], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// stripDelimiter returns the line without its newline and a carriage return preceding it, if any.
+func stripDelimiter(line []byte) []byte {
+	line, _ = bytes.CutSuffix(line, []byte("\n"))
+	line, _ = bytes.CutSuffix(line, []byte("\r"))
+	return line
+}
+
+// transform applies the configured transformations to a line read by a scanner. The result may still reference the buffer of the scanner. A kept newline is not subject to the transformations.
+func (p *Process) transform(b []byte) []byte {
+	if body, ok := bytes.CutSuffix(b, []byte("\n")); ok && p.options.keepDelimiter {
+		// if the transformed line still references the buffer of the scanner, appending writes within the original line
+		return append(p.transformLine(body), '\n')
+	}
+	return p.transformLine(b)
+}
+
+// transformLine applies the configured transformations to a line without newline.
+func (p *Process) transformLine(b []byte) []byte {
+	if p.options.trimCR {
+		b = bytes.TrimRight(b, "\r")
+	}
+	if p.options.outputDecoder != nil {
+		b = p.decode(b)
+	}
+	if p.options.dropInvalidUTF8 {
+		b = bytes.ToValidUTF8(b, nil)
+	}
+	return b
+}
+
+// own prepares a line for delivery. The scanner overwrites its buffer on the next scan, so the line is either copied or moved into one of the reused buffers. It must only be called for lines which are delivered, since moving a line into the reused buffers overwrites an earlier line.
+func (p *Process) own(buffers *lineBuffers, b []byte) []byte {
+	if !p.options.copyOutput {
+		return buffers.reuse(b)
+	}
+	return buffers.copy(b)
+}
+
+// Decoder transcodes bytes of some encoding to UTF-8. It is satisfied by *encoding.Decoder of golang.org/x/text/encoding, e.g. charmap.ISO8859_1.NewDecoder().
+type Decoder interface {
+	Bytes(b []byte) ([]byte, error)
+}
+
+// decode transcodes a line to UTF-8. A line which cannot be transcoded is delivered unchanged. The calls of the decoder are serialized since it is shared by the streams.
+func (p *Process) decode(b []byte) []byte {
+	p.decoderMutex.Lock()
+	defer p.decoderMutex.Unlock()
+	decoded, err := p.options.outputDecoder.Bytes(b)
+	if err != nil {
+		return b
+	}
+	return decoded
+}
+
+// slabSize is the size of the slabs short lines are copied into.
+const slabSize = 16 * 1024
+
+// lineBuffers holds the buffers of a stream for delivering lines.
+//
+// Copies of short lines are carved out of a shared slab instead of being allocated one by one, which amortizes the allocation over many lines. For processes emitting many tiny lines this removes nearly all allocations and improves the throughput (see BenchmarkRecvStdout); the remaining cost is dominated by the channel send per line, which is kept for the simplicity of the per-line API. The tradeoff is memory retention: a line which is retained by the consumer keeps its whole slab alive. Lines longer than a fraction of the slab are allocated individually to bound this overhead.
+//
+// Without copies, the line buffers alternate between two buffers for delivering lines without allocating. Delivered on an unbuffered channel, a line is not overwritten before the consumer received the following line.
+type lineBuffers struct {
+	slab    []byte
+	buffers [2][]byte
+	current int
+}
+
+func (b *lineBuffers) copy(line []byte) []byte {
+	if len(line) > slabSize/16 {
+		return append([]byte(nil), line...)
+	}
+	if cap(b.slab)-len(b.slab) < len(line) {
+		b.slab = make([]byte, 0, slabSize)
+	}
+	start := len(b.slab)
+	b.slab = append(b.slab, line...)
+	// limit the capacity, so that appending to the line does not overwrite the following lines
+	return b.slab[start:len(b.slab):len(b.slab)]
+}
+
+func (b *lineBuffers) reuse(line []byte) []byte {
+	b.current = 1 - b.current
+	b.buffers[b.current] = append(b.buffers[b.current][:0], line...)
+	return b.buffers[b.current]
+}
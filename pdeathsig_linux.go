@@ -0,0 +1,11 @@
+package goprocess
+
+import (
+	"syscall"
+)
+
+// setParentDeathSignal sets the signal sent to the process when the parent dies, see WithParentDeathSignal.
+func setParentDeathSignal(attr *syscall.SysProcAttr, signal syscall.Signal) error {
+	attr.Pdeathsig = signal
+	return nil
+}
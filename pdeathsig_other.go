@@ -0,0 +1,12 @@
+//go:build unix && !linux
+
+package goprocess
+
+import (
+	"syscall"
+)
+
+// setParentDeathSignal is not supported on this platform.
+func setParentDeathSignal(attr *syscall.SysProcAttr, signal syscall.Signal) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,72 @@
+package goprocess
+
+import (
+	"os"
+	"time"
+)
+
+// Options is a reusable set of common settings, e.g. a policy shared by all processes of a codebase. It is an alternative to the functional options for settings which are applied to many processes alike. The zero value of a field means the default of the corresponding functional option.
+type Options struct {
+	// ScannerBufferInitial and ScannerBufferMax correspond to WithScannerBuffer. They apply if ScannerBufferMax is set.
+	ScannerBufferInitial int
+	ScannerBufferMax     int
+	// GracePeriod corresponds to WithGracePeriod.
+	GracePeriod time.Duration
+	// StartTimeout corresponds to WithStartTimeout.
+	StartTimeout time.Duration
+	// StartupSilenceTimeout corresponds to WithStartupSilenceTimeout.
+	StartupSilenceTimeout time.Duration
+	// Dir corresponds to WithDir.
+	Dir string
+	// Env corresponds to WithEnv. It is shared by all processes and must not be modified while they are started.
+	Env map[string]string
+	// TrimCR corresponds to WithTrimCR.
+	TrimCR bool
+	// SkipEmptyLines corresponds to WithSkipEmptyLines.
+	SkipEmptyLines bool
+	// RecentLines corresponds to WithRecentLines.
+	RecentLines int
+	// Extra are further functional options applied after the fields.
+	Extra []Option
+}
+
+// Options returns the functional options corresponding to the settings, e.g. for passing them to New or StartProcess. A nil Options results in no options.
+func (o *Options) Options() []Option {
+	if o == nil {
+		return nil
+	}
+	var opts []Option
+	if o.ScannerBufferMax > 0 {
+		opts = append(opts, WithScannerBuffer(o.ScannerBufferInitial, o.ScannerBufferMax))
+	}
+	if o.GracePeriod > 0 {
+		opts = append(opts, WithGracePeriod(o.GracePeriod))
+	}
+	if o.StartTimeout > 0 {
+		opts = append(opts, WithStartTimeout(o.StartTimeout))
+	}
+	if o.StartupSilenceTimeout > 0 {
+		opts = append(opts, WithStartupSilenceTimeout(o.StartupSilenceTimeout))
+	}
+	if o.Dir != "" {
+		opts = append(opts, WithDir(o.Dir))
+	}
+	if o.Env != nil {
+		opts = append(opts, WithEnv(o.Env))
+	}
+	if o.TrimCR {
+		opts = append(opts, WithTrimCR())
+	}
+	if o.SkipEmptyLines {
+		opts = append(opts, WithSkipEmptyLines(true))
+	}
+	if o.RecentLines > 0 {
+		opts = append(opts, WithRecentLines(o.RecentLines))
+	}
+	return append(opts, o.Extra...)
+}
+
+// NewProcessWithOptions is like NewProcess, but takes the settings shared by many processes as Options. The functional options are applied after the settings of the Options, so they take precedence: e.g. a WithGracePeriod given as functional option replaces the GracePeriod of the Options.
+func NewProcessWithOptions(args []string, options *Options, stdin <-chan []byte, signals <-chan os.Signal, opts ...Option) (<-chan []byte, <-chan []byte, error) {
+	return NewProcess(args, stdin, signals, append(options.Options(), opts...)...)
+}
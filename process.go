@@ -1,12 +1,26 @@
+// Package goprocess provides a simple channel-based API for processes.
+//
+// The package is Unix-only (Linux, macOS and the BSDs): it relies on process groups, signals and wait statuses, which Windows does not have, and does not build on Windows. In particular, KillTree does not use job objects. Functionality which is only available on Linux returns ErrNotSupported on the other Unix platforms.
 package goprocess
 
 import (
 	"bufio"
+	"cmp"
+	"context"
 	"errors"
+	"fmt"
+	"maps"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
-	"io"
+	"time"
 )
 
 // Events that can occur and how the process object reacts to them:
@@ -16,7 +30,7 @@ import (
 // - signals gets closed: do nothing (consequence: killing is not possible anymore)
 // - process closes stdout pipe: close stdout channel
 // - process closes stderr pipe: close stderr channel
-// - process terminates: do nothing (pipes are closed automatically)
+// - process terminates: reap it, send the exit status on the exit channel (pipes are closed automatically)
 
 // NewProcess creates a new process in the background and provides a simple interface for standard I/O. It consumes and produces []byte messages that are received or will be sent to the process. The exchanged messages are split at newlines (so messages on the stdin-channel should not contain any newlines).
 //
@@ -44,81 +58,846 @@ import (
 // It is also possible to forward signals from the parent process to the created process:
 //
 //     signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
-func NewProcess(args []string, stdin <-chan []byte, signals <-chan os.Signal) (<-chan []byte, <-chan []byte, error) {
+//
+// The process is started immediately. Use New and Process.Start to separate the construction of the process from its start.
+func NewProcess(args []string, stdin <-chan []byte, signals <-chan os.Signal, opts ...Option) (<-chan []byte, <-chan []byte, error) {
+	p, err := StartProcess(args, stdin, signals, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p.Stdout(), p.Stderr(), nil
+}
+
+// Process is a process running in the background. It is created by New and launched by Start. The eager constructors StartProcess and NewProcess do both at once.
+type Process struct {
+	args    []string
+	options options
+	command *exec.Cmd
+	stdin   <-chan []byte
+	signals <-chan os.Signal
+	// stdinWriter is the end of the stdin-pipe written by the process
+	stdinWriter *os.File
+	stdout      output
+	stderr      output
+	// output is the merged channel of stdout and stderr if WithLines is given
+	output chan Line
+
+	// channels owned by the process if the caller did not provide them
+	stdinSender  chan []byte
+	signalSender chan os.Signal
+
+	writeRequests chan writeRequest
+	// stdinDone is closed when the stdin-pipe has been closed
+	stdinDone chan struct{}
+	// stdinClosed is whether the stdin-pipe has been closed
+	stdinClosed atomic.Bool
+
+	mutex   sync.Mutex
+	started bool
+	// env is the environment variables of WithEnv or WithEnvFunc the process was started with
+	env map[string]string
+	// groupLeader is whether the process leads a process group of its own
+	groupLeader  bool
+	stopped      bool
+	processState *os.ProcessState
+	waitErr      error
+	// done is closed when the process has exited and has been reaped
+	done chan struct{}
+	// context is cancelled when the process has exited
+	context       context.Context
+	cancelContext context.CancelCauseFunc
+	// header receives the first line of stdout if WithHeaderLine is given
+	header <-chan []byte
+	// errors receives the errors occurring in the background
+	errors chan error
+	// exit receives the exit status once the process has been reaped
+	exit chan ExitStatus
+	// firstOutput is closed when the first line has been read from stdout or stderr
+	firstOutput     chan struct{}
+	firstOutputOnce sync.Once
+	// startupFailed is whether the process has been terminated because it was silent after its start
+	startupFailed atomic.Bool
+	// outputsClosed is closed when the channels of stdout and stderr have been closed
+	outputsClosed chan struct{}
+
+	// sequence is the number of lines read from stdout and stderr
+	sequence atomic.Uint64
+	// openOutputs is the number of output streams which have not been closed yet
+	openOutputs atomic.Int32
+	// decoderMutex serializes the calls of the output decoder
+	decoderMutex sync.Mutex
+	// stdinClosedByProcess is closed once a write failed because the process closed its end of the stdin-pipe
+	stdinClosedByProcess     chan struct{}
+	stdinClosedByProcessOnce sync.Once
+	// sentinelRead is closed once the sentinel of WithConsumedSentinel has been read from stdout
+	sentinelRead     chan struct{}
+	sentinelReadOnce sync.Once
+	// stdinWritten is whether a message has been written to stdin, it is only accessed by the goroutine writing stdin
+	stdinWritten bool
+	// prebuilt is the command given to NewFromCmd, it is nil if the command is built by Start
+	prebuilt *exec.Cmd
+	// filter is the filter of WithOutputThrough, it is nil if there is no filter
+	filter *exec.Cmd
+	// discard is closed by DetachOutput
+	discard     chan struct{}
+	discardOnce sync.Once
+	// handoffs forward stdout and stderr to the consumer of Handoff, they are nil before the first hand-off
+	handoffs     []*handoffStream
+	handoffMutex sync.Mutex
+}
+
+// New creates a new process which is not started yet. The process is launched by calling Start. In between, the output channels returned by Stdout and Stderr are already available, so consumers can be set up before the process is able to produce any output.
+//
+// The first argument is the program and must not be empty. Empty arguments after it are passed to the process as they are, e.g. []string{"echo", ""}.
+//
+// If no stdin-channel is given via WithStdin, the process owns its stdin-channel which is returned by Stdin. The same applies to the signals-channel (WithSignals and Signals).
+func New(args []string, opts ...Option) (*Process, error) {
+	p, err := newProcess(args, opts)
+	if err != nil {
+		return nil, err
+	}
+	if p.options.allowedExecutables != nil {
+		// the checked executable is launched, even if the lookup would have a different result later
+		p.options.path, err = p.allowedExecutable(p.executableName())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// newProcess creates a new process like New, without checking the executable against the allowlist of WithAllowedExecutables.
+func newProcess(args []string, opts []Option) (*Process, error) {
 	if len(args) <= 0 {
-		return nil, nil, errors.New("no arguments specified")
+		return nil, errors.New("no arguments specified")
 	}
-	command := exec.Command(args[0], args[1:]...)
-	// https://medium.com/@felixge/killing-a-child-process-and-all-of-its-children-in-go-54079af94773
-	command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
-	stdinWriter, err := command.StdinPipe()
+	if args[0] == "" {
+		return nil, errors.New("empty program name")
+	}
+	p := &Process{
+		args:    append([]string(nil), args...),
+		options: options{copyOutput: true, gracePeriod: DefaultGracePeriod, processGroup: true, reaping: true},
+		done:    make(chan struct{}),
+		exit:    make(chan ExitStatus, 1),
+		errors:  make(chan error, errorsBufferSize),
+
+		outputsClosed: make(chan struct{}),
+		firstOutput:   make(chan struct{}),
+		discard:       make(chan struct{}),
+		writeRequests: make(chan writeRequest),
+		stdinDone:     make(chan struct{}),
+
+		stdinClosedByProcess: make(chan struct{}),
+		sentinelRead:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&p.options)
+	}
+	p.context, p.cancelContext = context.WithCancelCause(context.Background())
+	if p.options.stdinSource != nil && p.options.stdin != nil {
+		return nil, errors.New("stdin configured by both a file and a channel")
+	}
+	if p.options.stdoutTarget != nil && p.options.stdoutFunc != nil {
+		return nil, errors.New("stdout configured by both a file and a callback")
+	}
+	if p.options.stderrTarget != nil && p.options.stderrFunc != nil {
+		return nil, errors.New("stderr configured by both a file and a callback")
+	}
+	if p.options.combinedOutput && (p.options.stderrTarget != nil || p.options.stderrFunc != nil) {
+		return nil, errors.New("combined output configured with a separate stderr")
+	}
+	if p.options.outputFilter != nil && (len(p.options.outputFilter) == 0 || p.options.outputFilter[0] == "") {
+		return nil, errors.New("empty output filter")
+	}
+	if p.options.stdoutWhole && p.options.headerLine {
+		return nil, errors.New("stdout configured as a whole with a header line")
+	}
+	if p.options.fixedChunkSize != 0 {
+		max := p.options.scannerBufferMax
+		if max <= 0 {
+			max = bufio.MaxScanTokenSize
+		}
+		if p.options.fixedChunkSize < 0 || p.options.fixedChunkSize > max {
+			return nil, fmt.Errorf("invalid chunk size %d", p.options.fixedChunkSize)
+		}
+		if p.options.stdoutWhole {
+			return nil, errors.New("stdout configured in both whole and fixed chunks")
+		}
+	}
+	if p.options.allowedExecutables != nil {
+		if p.options.shell != "" {
+			return nil, errors.New("allowed executables configured with a shell")
+		}
+		if p.options.outputFilter != nil {
+			filter, err := p.allowedExecutable(p.options.outputFilter[0])
+			if err != nil {
+				return nil, err
+			}
+			p.options.outputFilter = append([]string{filter}, p.options.outputFilter[1:]...)
+		}
+	}
+	if p.options.stdinBuffer < 0 {
+		return nil, fmt.Errorf("invalid stdin buffer capacity %d", p.options.stdinBuffer)
+	}
+	if p.options.hasUmask && (p.options.umask < 0 || p.options.umask > 0o777) {
+		return nil, fmt.Errorf("invalid umask %#o", p.options.umask)
+	}
+	if p.options.path != "" && p.preExec() != nil {
+		return nil, errors.New("path configured with a setup by the shell (WithUmask or WithSocketActivation)")
+	}
+	if p.options.socketActivation && len(p.options.extraFiles) == 0 {
+		return nil, errors.New("socket activation configured without extra files")
+	}
+	if p.options.detach && (p.options.stdin != nil || p.options.stdoutFunc != nil || p.options.stderrFunc != nil) {
+		return nil, errors.New("detached process configured with a stdin-channel or an output callback")
+	}
+	outputBufferSize := 1024
+	if !p.options.copyOutput {
+		outputBufferSize = 0
+	}
+	if p.options.headerLine && p.options.stdoutTarget == nil && !p.options.detach {
+		p.stdout.header = make(chan []byte, 1)
+		p.header = p.stdout.header
+	}
+	if p.options.recentLines > 0 {
+		p.stdout.recent = newRing(p.options.recentLines)
+		p.stderr.recent = newRing(p.options.recentLines)
+	}
+	if p.options.stderrAsError && p.stderr.recent == nil {
+		p.stderr.recent = newRing(stderrErrorLines)
+	}
+	p.stdout.stream = StreamStdout
+	p.stdout.discard, p.stderr.discard = p.discard, p.discard
+	p.stderr.stream = StreamStderr
+	p.stdout.callback = p.options.stdoutFunc
+	p.stderr.callback = p.options.stderrFunc
+	if p.options.lines {
+		p.output = make(chan Line, outputBufferSize)
+	} else {
+		if p.stdout.callback == nil && p.options.stdoutTarget == nil && !p.options.detach {
+			p.stdout.lines = make(chan []byte, outputBufferSize)
+		}
+		if p.stderr.callback == nil && p.options.stderrTarget == nil && !p.options.detach && !p.options.combinedOutput {
+			p.stderr.lines = make(chan []byte, outputBufferSize)
+		}
+	}
+	p.stdin = p.options.stdin
+	if p.stdin == nil && p.options.stdinSource == nil && !p.options.detach {
+		p.stdinSender = make(chan []byte, p.options.stdinBuffer)
+		p.stdin = p.stdinSender
+	}
+	p.signals = p.options.signals
+	if p.signals == nil {
+		p.signalSender = make(chan os.Signal)
+		p.signals = p.signalSender
+	}
+	return p, nil
+}
+
+// StartProcess creates a new process in the background like NewProcess does but returns a Process instead of the output channels. See NewProcess for the semantics of the arguments and channels.
+func StartProcess(args []string, stdin <-chan []byte, signals <-chan os.Signal, opts ...Option) (*Process, error) {
+	p, err := New(args, append([]Option{WithStdin(stdin), WithSignals(signals)}, opts...)...)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	stdoutPipe, err := command.StdoutPipe()
+	err = p.Start()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewFromCmd creates a new process like New, but launches the given command instead of building one from arguments, e.g. a command created by exec.CommandContext with Dir, Env, SysProcAttr and ExtraFiles configured by the caller. The package only wires up stdin, stdout and stderr, so they must not be set, and the command must not have been started. If SysProcAttr is nil, the process group (see WithProcessGroup) and WithDetach are applied as usual; otherwise the attributes of the caller are used as they are, and signals are sent to the process group only if the process leads one.
+//
+// Options configuring the command itself (WithPath, WithShell, WithDir, WithEnv, WithEnvFunc, WithForceColor, WithNoColor, WithExtraFiles, WithSocketActivation, WithParentDeathSignal and WithUmask) cannot be combined with it. The command is owned by the process afterwards and must not be modified.
+func NewFromCmd(command *exec.Cmd, opts ...Option) (*Process, error) {
+	if command.Stdin != nil || command.Stdout != nil || command.Stderr != nil {
+		return nil, errors.New("command with stdin, stdout or stderr already set")
+	}
+	if command.Process != nil {
+		return nil, ErrAlreadyStarted
 	}
-	stdoutScanner := bufio.NewScanner(stdoutPipe)
-	stderrPipe, err := command.StderrPipe()
+	args := command.Args
+	if len(args) == 0 {
+		args = []string{command.Path}
+	}
+	p, err := newProcess(args, opts)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	if p.options.allowedExecutables != nil {
+		if _, err := p.allowedExecutable(command.Path); err != nil {
+			return nil, err
+		}
 	}
-	stderrScanner := bufio.NewScanner(stderrPipe)
-	err = command.Start()
+	o := p.options
+	if o.path != "" || o.shell != "" || o.dir != "" || o.env != nil || o.colorEnv != nil || o.extraFiles != nil || o.socketActivation || o.parentDeathSignal != 0 || o.hasUmask {
+		return nil, errors.New("options configuring the command given with a prebuilt command")
+	}
+	p.prebuilt = command
+	return p, nil
+}
+
+// Start launches the process. A process can only be started once. If the process cannot be started, the returned error wraps ErrNotFound, ErrPermission, ErrBinaryBusy, ErrExecFormat or ErrStart (and ErrStartTimeout if the start timed out, see WithStartTimeout).
+func (p *Process) Start() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.started {
+		return ErrAlreadyStarted
+	}
+	if p.options.context != nil {
+		if err := p.options.context.Err(); err != nil {
+			return err
+		}
+	}
+	command := p.prebuilt
+	if command == nil {
+		if err := p.lookPreExecExecutable(); err != nil {
+			return err
+		}
+		command = p.newCommand()
+	} else if command.SysProcAttr == nil {
+		command.SysProcAttr = p.sysProcAttr()
+	}
+	if p.options.parentDeathSignal != 0 {
+		err := setParentDeathSignal(command.SysProcAttr, p.options.parentDeathSignal)
+		if err != nil {
+			return err
+		}
+	}
+	// The pipes are created manually instead of using StdinPipe etc., so that Wait does not close them. This allows to reap the process as soon as it exits while its output is still being consumed.
+	var files pipes
+	stdinSource, stdoutTarget, stderrTarget := p.options.stdinSource, p.options.stdoutTarget, p.options.stderrTarget
+	if p.options.detach {
+		// a detached process must not depend on pipes to the parent, which break when the parent exits
+		null, err := files.devNull()
+		if err != nil {
+			return err
+		}
+		stdinSource = cmp.Or(stdinSource, null)
+		stdoutTarget = cmp.Or(stdoutTarget, null)
+		stderrTarget = cmp.Or(stderrTarget, null)
+	}
+	stdinFile, stdinWriter, err := files.open(stdinSource, true)
 	if err != nil {
-		return nil, nil, err
+		return err
+	}
+	stdoutFile, stdoutReader, err := files.open(stdoutTarget, false)
+	if err != nil {
+		return err
+	}
+	var stderrFile, stderrReader *os.File
+	if p.options.combinedOutput {
+		// both streams share the pipe of stdout, so the kernel keeps the order of the writes
+		stderrFile = stdoutFile
+	} else {
+		stderrFile, stderrReader, err = files.open(stderrTarget, false)
+		if err != nil {
+			return err
+		}
+	}
+	command.Stdin = stdinFile
+	command.Stdout = stdoutFile
+	command.Stderr = stderrFile
+	childFiles := files.child
+	var filter *exec.Cmd
+	var filterFiles []*os.File
+	if p.options.outputFilter != nil {
+		filter, childFiles, filterFiles, err = p.prepareFilter(command, &files)
+		if err != nil {
+			return err
+		}
+	}
+	err = p.startCommand(command, childFiles, files.parent)
+	if err != nil {
+		closeFiles(filterFiles...)
+		return err
+	}
+	p.command = command
+	p.groupLeader = (p.options.processGroup || p.options.detach) && leadsProcessGroup(command.Process.Pid)
+	if filter != nil {
+		err = p.startFilter(filter, filterFiles, files.parent)
+		if err != nil {
+			p.command = nil
+			return err
+		}
+	}
+	if p.options.pidFile != "" {
+		err := os.WriteFile(p.options.pidFile, []byte(strconv.Itoa(command.Process.Pid)+"\n"), 0644)
+		if err != nil {
+			p.reportError(err)
+		}
+	}
+	p.stdinWriter = stdinWriter
+	p.started = true
+	if stdinWriter != nil {
+		p.sendStdin(stdinWriter)
+	} else {
+		p.stdinClosed.Store(true)
+		close(p.stdinDone)
+	}
+	if p.options.stderrDebounceMax > 0 && stderrReader != nil {
+		p.stderr.debounce = p.newStderrDebouncer()
+	}
+	if p.options.stderrCoalesce && stderrReader != nil {
+		p.stderr.coalesce = p.newStderrCoalescer()
+	}
+	var outputs int32
+	for _, reader := range []*os.File{stdoutReader, stderrReader} {
+		if reader != nil {
+			outputs++
+		}
+	}
+	if p.options.stderrAsError && stderrReader != nil {
+		p.stderr.written = make(chan struct{})
+	}
+	p.openOutputs.Store(outputs)
+	if outputs == 0 {
+		p.closeOutputs()
+	}
+	if stdoutReader != nil {
+		p.recv(&p.stdout, stdoutReader)
+	}
+	if stderrReader != nil {
+		p.recv(&p.stderr, stderrReader)
+	}
+	p.forwardSignals()
+	p.watchStop()
+	p.watchStartupSilence()
+	if !p.options.reaping {
+		// without reaping, the exit can only be detected by the end of the output
+		go func() {
+			<-p.outputsClosed
+			if p.filter != nil {
+				// the filter is internal, so the caller cannot reap it
+				p.filter.Wait()
+			}
+			p.cancelContext(ErrExited)
+			close(p.exit)
+			close(p.done)
+		}()
+		return nil
 	}
-	sendStdin(stdinWriter, stdin)
-	stdout := recvStdout(stdoutScanner)
-	stderr := recvStderr(stderrScanner)
-	forwardSignals(command, signals)
 	go func() {
-		command.Wait()
+		err := command.Wait()
+		if p.filter != nil {
+			// the filter exits once it has read the end of the output
+			p.filter.Wait()
+		}
+		if err == nil && p.stderr.written != nil {
+			err = p.stderrError()
+		}
+		p.mutex.Lock()
+		p.processState = command.ProcessState
+		p.waitErr = err
+		p.mutex.Unlock()
+		if err != nil {
+			p.cancelContext(fmt.Errorf("%w: %w", ErrExited, err))
+		} else {
+			p.cancelContext(ErrExited)
+		}
+		p.exit <- newExitStatus(command.ProcessState)
+		close(p.exit)
+		close(p.done)
 	}()
-	return stdout, stderr, nil
+	return nil
 }
 
-func sendStdin(stdinWriter io.WriteCloser, stdin <-chan []byte) {
-	go func() {
-		for msg := range stdin {
-			_, err := stdinWriter.Write(append(msg, "\n"...))
-			if err != nil {
-				// ignore write error
-				continue
-			}
+// newCommand creates the command of the process as configured by the options.
+func (p *Process) newCommand() *exec.Cmd {
+	args := p.commandArgs()
+	command := exec.Command(args[0], args[1:]...)
+	if p.options.path != "" && p.options.shell == "" && p.preExec() == nil {
+		command = exec.Command(p.options.path, p.args[1:]...)
+		command.Args[0] = p.args[0]
+	}
+	command.Dir = p.options.dir
+	if p.options.env != nil || p.options.colorEnv != nil {
+		// the variables of WithEnv and WithEnvFunc take precedence over the ones of WithForceColor and WithNoColor
+		env := maps.Clone(p.options.colorEnv)
+		if env == nil {
+			env = make(map[string]string)
 		}
-		stdinWriter.Close()
-	}()
+		if p.options.env != nil {
+			p.env = p.options.env()
+			maps.Copy(env, p.env)
+		}
+		command.Env = environ(os.Environ(), env)
+	}
+	if p.options.socketActivation {
+		base := command.Env
+		if base == nil {
+			base = os.Environ()
+		}
+		command.Env = environ(base, p.listenEnv())
+	}
+	command.ExtraFiles = p.options.extraFiles
+	command.SysProcAttr = p.sysProcAttr()
+	return command
 }
 
-func recvStdout(stdoutScanner *bufio.Scanner) <-chan []byte {
-	stdout := make(chan []byte, 1024)
-	go func() {
-		for stdoutScanner.Scan() {
-			stdout <- stdoutScanner.Bytes()
+// sysProcAttr returns the attributes of the process controlling its process group or session.
+func (p *Process) sysProcAttr() *syscall.SysProcAttr {
+	// https://medium.com/@felixge/killing-a-child-process-and-all-of-its-children-in-go-54079af94773
+	// a session leader (Setsid) leads a process group of its own and must not call Setpgid
+	return &syscall.SysProcAttr{Setpgid: p.options.processGroup && !p.options.detach, Setsid: p.options.detach}
+}
+
+// environ returns the environment base with the variables of env added. Variables of env replace variables of base with the same name.
+func environ(base []string, env map[string]string) []string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make([]string, 0, len(base)+len(env))
+	for _, variable := range base {
+		name, _, _ := strings.Cut(variable, "=")
+		if _, ok := env[name]; !ok {
+			result = append(result, variable)
 		}
-		close(stdout)
-	}()
-	return stdout
+	}
+	for _, name := range names {
+		result = append(result, name+"="+env[name])
+	}
+	return result
 }
 
-func recvStderr(stderrScanner *bufio.Scanner) <-chan []byte {
-	stderr := make(chan []byte, 1024)
-	go func() {
-		for stderrScanner.Scan() {
-			stderr <- stderrScanner.Bytes()
+// executableName returns the name of the executable of the process as given by the options, to be looked up like exec.Command does. A relative path is evaluated relative to the working directory of the process.
+func (p *Process) executableName() string {
+	name := cmp.Or(p.options.path, p.args[0])
+	if p.options.dir != "" && !filepath.IsAbs(name) && strings.ContainsRune(name, filepath.Separator) {
+		name = filepath.Join(p.options.dir, name)
+	}
+	return name
+}
+
+// lookPreExecExecutable looks up the executable of a process started by the shell of preExec, so that Start fails like for a process started directly if it does not exist or is not executable. The shell would only report the failure by its exit status.
+func (p *Process) lookPreExecExecutable() error {
+	if p.preExec() == nil {
+		return nil
+	}
+	name := p.executableName()
+	if p.options.shell != "" {
+		name = p.options.shell
+	}
+	if _, err := exec.LookPath(name); err != nil {
+		return classifyStartError(err)
+	}
+	return nil
+}
+
+// allowedExecutable resolves the executable like exec.Command does and returns its absolute path if it is in the allowlist of WithAllowedExecutables. Otherwise the returned error wraps ErrExecutableNotAllowed.
+func (p *Process) allowedExecutable(name string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err == nil {
+		path, err = filepath.Abs(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrExecutableNotAllowed, err)
+	}
+	if !slices.Contains(p.options.allowedExecutables, path) {
+		return "", fmt.Errorf("%w: %s", ErrExecutableNotAllowed, path)
+	}
+	return path, nil
+}
+
+// commandArgs returns the arguments of the command launching the process, which differ from the arguments of the process if it is run by a shell.
+func (p *Process) commandArgs() []string {
+	args := p.args
+	if p.options.shell != "" {
+		flags := "-c"
+		if p.options.loginShell {
+			flags = "-lc"
 		}
-		close(stderr)
-	}()
-	return stderr
+		// exec replaces the shell, so that the process keeps the pid and receives the signals itself
+		args = []string{p.options.shell, flags, "exec " + shellQuote(p.args)}
+	} else if p.options.path != "" && p.preExec() != nil {
+		args = append([]string{p.options.path}, args[1:]...)
+	}
+	if preExec := p.preExec(); preExec != nil {
+		// Go cannot run code between fork and exec: a shell runs the setup instead and replaces itself by the process, which keeps the pid
+		args = append([]string{"/bin/sh", "-c", strings.Join(append(preExec, `exec "$@"`), "; "), "sh"}, args...)
+	}
+	return args
 }
 
-func forwardSignals(command *exec.Cmd, signals <-chan os.Signal) {
+// preExec returns the shell commands setting up the process after the fork, or nil if no setup is needed.
+func (p *Process) preExec() []string {
+	var commands []string
+	if p.options.hasUmask {
+		commands = append(commands, fmt.Sprintf("umask %04o", p.options.umask))
+	}
+	if p.options.socketActivation {
+		// LISTEN_PID must be the pid of the process, which is only known after the fork
+		commands = append(commands, "LISTEN_PID=$$", "export LISTEN_PID")
+	}
+	return commands
+}
+
+// listenEnv returns the variables of the socket activation protocol except LISTEN_PID, see WithSocketActivation.
+func (p *Process) listenEnv() map[string]string {
+	env := map[string]string{"LISTEN_FDS": strconv.Itoa(len(p.options.extraFiles))}
+	if p.options.listenNames != nil {
+		env["LISTEN_FDNAMES"] = strings.Join(p.options.listenNames, ":")
+	}
+	return env
+}
+
+// shellQuote quotes the arguments for a POSIX shell, so that the shell passes them literally.
+func shellQuote(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// startCommand starts the command and closes the ends of the pipes passed to the process (childFiles), which are not needed in the parent anymore. If the start fails, the ends of the parent (parentFiles) are closed as well.
+//
+// If the start does not complete within the start timeout, an error wrapping ErrStartTimeout is returned while the start goes on in the background. Once it completes, the process is killed and reaped and all files are closed, so that no half-started process leaks.
+func (p *Process) startCommand(command *exec.Cmd, childFiles []*os.File, parentFiles []*os.File) error {
+	result := make(chan error, 1)
 	go func() {
-		for s := range signals {
-			// https://medium.com/@felixge/killing-a-child-process-and-all-of-its-children-in-go-54079af94773
-			syscall.Kill(-command.Process.Pid, s.(syscall.Signal))
+		if p.options.resetSIGPIPE {
+			result <- startCommandWithDefaultSIGPIPE(command)
+			return
 		}
+		result <- command.Start()
 	}()
-}
\ No newline at end of file
+	var timeout <-chan time.Time
+	if p.options.startTimeout > 0 {
+		timer := p.clock().NewTimer(p.options.startTimeout)
+		defer timer.Stop()
+		timeout = timer.C()
+	}
+	select {
+	case err := <-result:
+		closeFiles(childFiles...)
+		if err != nil {
+			closeFiles(parentFiles...)
+			return classifyStartError(err)
+		}
+		return nil
+	case <-timeout:
+		go func() {
+			err := <-result
+			closeFiles(childFiles...)
+			closeFiles(parentFiles...)
+			if err == nil {
+				command.Process.Kill()
+				command.Wait()
+			}
+		}()
+		return fmt.Errorf("%w: %w after %v", ErrStart, ErrStartTimeout, p.options.startTimeout)
+	}
+}
+
+// pipes collects the pipes of the standard streams while a process is being started.
+type pipes struct {
+	// child are the ends of the pipes used by the process, they are closed by the parent after the start
+	child []*os.File
+	// parent are the ends of the pipes used by the parent
+	parent []*os.File
+}
+
+// devNull returns the null device opened for reading and writing. Like the ends of the pipes used by the process, it is closed by the parent after the start.
+func (s *pipes) devNull() (*os.File, error) {
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	s.child = append(s.child, null)
+	return null, nil
+}
+
+// open returns the file for a standard stream of the process and the end of its pipe used by the parent. If a file of the caller is given, it is used directly and there is no pipe. If creating the pipe fails, all pipes are closed.
+func (s *pipes) open(file *os.File, childReads bool) (*os.File, *os.File, error) {
+	if file != nil {
+		return file, nil, nil
+	}
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		closeFiles(s.child...)
+		closeFiles(s.parent...)
+		return nil, nil, err
+	}
+	child, parent := writer, reader
+	if childReads {
+		child, parent = reader, writer
+	}
+	s.child = append(s.child, child)
+	s.parent = append(s.parent, parent)
+	return child, parent, nil
+}
+
+func closeFiles(files ...*os.File) {
+	for _, file := range files {
+		file.Close()
+	}
+}
+
+// AppendArgs appends arguments to the arguments of the process. It allows adding flags conditionally before the process is started, e.g. in a builder-style flow. After the process has been started, it returns ErrAlreadyStarted.
+func (p *Process) AppendArgs(args ...string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.started {
+		return ErrAlreadyStarted
+	}
+	p.args = append(p.args, args...)
+	if p.prebuilt != nil {
+		p.prebuilt.Args = append(p.prebuilt.Args, args...)
+	}
+	return nil
+}
+
+// Stdin returns the stdin-channel owned by the process. Closing it closes the stdin-pipe of the process. It returns nil if the stdin-channel has been provided via WithStdin.
+func (p *Process) Stdin() chan<- []byte {
+	return p.stdinSender
+}
+
+// Signals returns the signals-channel owned by the process. It returns nil if the signals-channel has been provided via WithSignals.
+//
+// The signals-channel is only consumed once the process has been started: a signal sent before Start is not lost but blocks the sender until Start, and it is forwarded to the process right after its start. Signals sent after the process exited are dropped.
+func (p *Process) Signals() chan<- os.Signal {
+	return p.signalSender
+}
+
+// Stdout returns the channel on which the lines written by the process to its stdout are received. It returns nil if WithLines or WithStdoutFunc is given.
+func (p *Process) Stdout() <-chan []byte {
+	return p.stdout.lines
+}
+
+// Stderr returns the channel on which the lines written by the process to its stderr are received. It returns nil if WithLines or WithStderrFunc is given.
+func (p *Process) Stderr() <-chan []byte {
+	return p.stderr.lines
+}
+
+// Header returns the channel on which the first line of stdout is received if WithHeaderLine is given. The channel is closed after the header, or without any line if stdout has been closed before writing a line. It returns nil if WithHeaderLine is not given or stdout is connected to a file by WithStdoutTarget.
+func (p *Process) Header() <-chan []byte {
+	return p.header
+}
+
+// Lines returns the channel on which the lines written by the process to its stdout and stderr are received if WithLines is given. The channel is closed when the process closed both pipes. It returns nil if WithLines is not given.
+func (p *Process) Lines() <-chan Line {
+	return p.output
+}
+
+// Cmd returns the underlying command of the process. The command is live and must be treated as read-only: modifying it after the process has been started has no effect or leads to undefined behavior. Cmd returns nil before the process has been started.
+//
+// The following fields are safe to read at any time: Path, Args, Env, Dir, SysProcAttr and Process.
+//
+// The ProcessState field is written by a background goroutine when the process exits and must not be read via the command. Use Process.ProcessState instead.
+func (p *Process) Cmd() *exec.Cmd {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.command
+}
+
+// Pid returns the pid of the process. It returns 0 before the process has been started. The pid stays the same after the process exited, but it may have been reused by another process by then.
+func (p *Process) Pid() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.command == nil {
+		return 0
+	}
+	return p.command.Process.Pid
+}
+
+// ProcessState returns the state of the exited process. It returns nil as long as the process has not exited (and has not been reaped).
+func (p *Process) ProcessState() *os.ProcessState {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.processState
+}
+
+// Wait blocks until the process has exited and returns the result of waiting for it. The error is nil if the process exited successfully and of type *exec.ExitError if it exited unsuccessfully. Wait can be called any number of times and from multiple goroutines.
+//
+// The process is always reaped by the package as soon as it exits, regardless of whether Wait is called or the output is consumed.
+func (p *Process) Wait() error {
+	p.mutex.Lock()
+	started := p.started
+	p.mutex.Unlock()
+	if !started {
+		return ErrNotStarted
+	}
+	<-p.done
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.waitErr
+}
+
+// Done returns a channel which is closed when the process has exited and has been reaped.
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+// Context returns a context which is cancelled when the process has exited and has been reaped, e.g. to abort work tied to the lifetime of the process. Its cause (see context.Cause) wraps ErrExited and, if the process exited unsuccessfully, the *exec.ExitError carrying the exit code or signal. Without reaping (see WithReaping), it is cancelled with ErrExited once the outputs have been closed.
+func (p *Process) Context() context.Context {
+	return p.context
+}
+
+// OutputsClosed returns a channel which is closed after both the stdout- and the stderr-channel (or the channel returned by Lines) have been closed, i.e. the process finished producing output. Usually this happens when the process exits, but descendants of the process may keep the pipes open for longer.
+func (p *Process) OutputsClosed() <-chan struct{} {
+	return p.outputsClosed
+}
+
+// UserTime returns the user CPU time consumed by the exited process and its waited-for children. It returns 0 as long as the process has not exited.
+func (p *Process) UserTime() time.Duration {
+	state := p.ProcessState()
+	if state == nil {
+		return 0
+	}
+	return state.UserTime()
+}
+
+// SystemTime returns the system CPU time consumed by the exited process and its waited-for children. It returns 0 as long as the process has not exited.
+func (p *Process) SystemTime() time.Duration {
+	state := p.ProcessState()
+	if state == nil {
+		return 0
+	}
+	return state.SystemTime()
+}
+
+// MaxRSS returns the maximum resident set size of the exited process in bytes, as reported by the resource usage of the platform. It returns 0 as long as the process has not exited, and on platforms which do not report it.
+func (p *Process) MaxRSS() int64 {
+	state := p.ProcessState()
+	if state == nil {
+		return 0
+	}
+	return maxRSS(state)
+}
+
+// BufferHighWater returns the largest amount of data the scanners reading stdout and stderr had to buffer so far. A scanner grows its buffer (up to the maximum configured by WithScannerBuffer) when the buffered data does not contain a complete line, so the high-water mark indicates the buffer size required by the longest lines. It helps right-sizing the buffers for steady-state vs. worst-case lines.
+func (p *Process) BufferHighWater() (stdout int, stderr int) {
+	return int(p.stdout.highWater.Load()), int(p.stderr.highWater.Load())
+}
+
+// ScanStats are statistics of splitting a stream into lines, see Process.Stats.
+type ScanStats struct {
+	// LongestLine is the length of the longest line so far in bytes (without the newline unless WithKeepDelimiter is given).
+	LongestLine int
+	// BufferGrowths is the number of times the buffer of the scanner had to grow, see WithScannerBuffer.
+	BufferGrowths int
+	// Bytes is the number of bytes read from the pipe so far.
+	Bytes int64
+}
+
+// Stats returns the statistics of splitting stdout and stderr into lines so far, e.g. to right-size the buffers of WithScannerBuffer and WithReadBufferSize for the workload. The statistics are updated while the streams are read and can be read concurrently at any time. The output of WithStdoutWhole is not split into lines and therefore not counted.
+func (p *Process) Stats() (stdout ScanStats, stderr ScanStats) {
+	return p.stdout.scanStats(), p.stderr.scanStats()
+}
+
+// Stalls is the backpressure a stream has experienced, see Process.Stalls.
+type Stalls struct {
+	// Count is the number of lines whose delivery blocked because the channel was full.
+	Count int64
+	// Duration is the total time the deliveries blocked.
+	Duration time.Duration
+}
+
+// Stalls returns the backpressure on stdout and stderr so far: how often and how long reading the stream blocked because the channel of the stream (or the channel returned by Lines) was full. While reading is blocked, the pipe fills up and the process blocks on writing, so stalls indicate a slow consumer throttling the process. Lines delivered to a callback are not counted.
+func (p *Process) Stalls() (stdout Stalls, stderr Stalls) {
+	return p.stdout.stallsSoFar(), p.stderr.stallsSoFar()
+}
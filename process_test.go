@@ -2,8 +2,19 @@ package goprocess
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"os"
+	"os/exec"
+	"os/signal"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -245,3 +256,2886 @@ func TestProcessTerminate(t *testing.T) {
 		t.Fatalf("Process send %v to stdout, expected %v.", stdoutMessages[0], []byte("Test"))
 	}
 }
+
+// TestProcessCmd tests if the underlying command and the process state are accessible. The test succeeds if the command reflects the given arguments and the process state becomes available after the process terminated within 1 second.
+func TestProcessCmd(t *testing.T) {
+	stdin := make(chan []byte)
+	signals := make(chan os.Signal)
+	p, err := StartProcess([]string{"echo", "Test"}, stdin, signals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close(signals)
+	defer close(stdin)
+	command := p.Cmd()
+	if len(command.Args) != 2 || command.Args[0] != "echo" || command.Args[1] != "Test" {
+		t.Fatalf("Command has arguments %v, expected %v.", command.Args, []string{"echo", "Test"})
+	}
+	if command.Process == nil {
+		t.Fatal("Command has no process after start.")
+	}
+	timeout := time.After(time.Second)
+	for p.ProcessState() == nil {
+		select {
+		case <-timeout:
+			t.Fatal("The process state is not available after 1 second.")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if !p.ProcessState().Exited() {
+		t.Fatal("The process state does not report an exited process.")
+	}
+}
+
+// TestProcessStart tests if a process created by New is launched by Start only. The test uses the stdin-channel owned by the process. The test succeeds if the output sent by the process is received on the channel obtained before the start, the process terminates within 1 second after closing the stdin-channel and a second start fails.
+func TestProcessStart(t *testing.T) {
+	p, err := New([]string{"cat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Cmd() != nil {
+		t.Fatal("The process has a command before it has been started.")
+	}
+	stdout := p.Stdout()
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Stdin() <- []byte("Test")
+	close(p.Stdin())
+	done := make(chan struct{})
+	var stdoutMessages [][]byte
+	go func() {
+		for msg := range stdout {
+			stdoutMessages = append(stdoutMessages, msg)
+		}
+		Drain(p.Stderr())
+		done <- struct{}{}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("After closing the stdin-channel, the process did not terminate after 1 second.")
+	}
+	if len(stdoutMessages) != 1 || bytes.Compare(stdoutMessages[0], []byte("Test")) != 0 {
+		t.Fatalf("Process send %q to stdout, expected %q.", stdoutMessages, [][]byte{[]byte("Test")})
+	}
+	if err := p.Start(); err == nil {
+		t.Fatal("Starting the process a second time did not fail.")
+	}
+}
+
+// TestProcessCopyOutput tests if delivered lines are independent of each other. The test retains all lines of a process printing many lines. The test succeeds if every retained line still has its original content after the process terminated.
+func TestProcessCopyOutput(t *testing.T) {
+	stdin := make(chan []byte)
+	signals := make(chan os.Signal)
+	stdout, stderr, err := NewProcess([]string{"seq", "10000"}, stdin, signals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close(signals)
+	defer close(stdin)
+	var stdoutMessages [][]byte
+	for msg := range stdout {
+		stdoutMessages = append(stdoutMessages, msg)
+	}
+	for range stderr {
+	}
+	if len(stdoutMessages) != 10000 {
+		t.Fatalf("Got %d messages, expected %d messages.", len(stdoutMessages), 10000)
+	}
+	for i, msg := range stdoutMessages {
+		if string(msg) != strconv.Itoa(i+1) {
+			t.Fatalf("Message %d is %q, expected %q.", i, msg, strconv.Itoa(i+1))
+		}
+	}
+}
+
+// TestProcessReferenceOutput tests the contract of disabled copies: a line is valid until the next receive. The test succeeds if every line received from a process printing many lines keeps its original content while it is processed.
+func TestProcessReferenceOutput(t *testing.T) {
+	stdin := make(chan []byte)
+	signals := make(chan os.Signal)
+	stdout, stderr, err := NewProcess([]string{"seq", "10000"}, stdin, signals, WithCopyOutput(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close(signals)
+	defer close(stdin)
+	go func() {
+		for range stderr {
+		}
+	}()
+	i := 0
+	for msg := range stdout {
+		time.Sleep(time.Microsecond)
+		if string(msg) != strconv.Itoa(i+1) {
+			t.Fatalf("Message %d is %q, expected %q.", i, msg, strconv.Itoa(i+1))
+		}
+		i++
+	}
+	if i != 10000 {
+		t.Fatalf("Got %d messages, expected %d messages.", i, 10000)
+	}
+}
+
+func benchmarkOutput(b *testing.B, opts ...Option) {
+	for i := 0; i < b.N; i++ {
+		stdin := make(chan []byte)
+		signals := make(chan os.Signal)
+		stdout, stderr, err := NewProcess([]string{"seq", "100000"}, stdin, signals, opts...)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for range stdout {
+		}
+		for range stderr {
+		}
+		close(stdin)
+		close(signals)
+	}
+}
+
+// BenchmarkCopyOutput measures the throughput of a process printing many short lines which are copied on delivery.
+func BenchmarkCopyOutput(b *testing.B) {
+	benchmarkOutput(b)
+}
+
+// BenchmarkReferenceOutput measures the throughput of a process printing many short lines which are delivered in reused buffers.
+func BenchmarkReferenceOutput(b *testing.B) {
+	benchmarkOutput(b, WithCopyOutput(false))
+}
+
+func benchmarkSmallWrites(b *testing.B, opts ...Option) {
+	for i := 0; i < b.N; i++ {
+		p, err := StartProcess([]string{"awk", "BEGIN { for (i = 0; i < 100000; i++) { print i; fflush() } }"}, nil, nil, opts...)
+		if err != nil {
+			b.Fatal(err)
+		}
+		DrainAll(p)
+	}
+}
+
+// BenchmarkSmallWrites measures the throughput of a process flushing every line.
+func BenchmarkSmallWrites(b *testing.B) {
+	benchmarkSmallWrites(b)
+}
+
+// BenchmarkSmallWritesReadBuffer measures the throughput of a process flushing every line which is read through a read buffer.
+func BenchmarkSmallWritesReadBuffer(b *testing.B) {
+	benchmarkSmallWrites(b, WithReadBufferSize(64*1024))
+}
+
+// TestProcessTerminateGracefully tests if terminating a process stops it and records the intentional stop. The test succeeds if Terminate returns within 1 second and the process is reported as intentionally stopped.
+func TestProcessTerminateGracefully(t *testing.T) {
+	p, err := New([]string{"sleep", "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Terminate(time.Second)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The process did not terminate after 1 second.")
+	}
+	if !p.IntentionallyStopped() {
+		t.Fatal("The terminated process is not reported as intentionally stopped.")
+	}
+}
+
+// TestProcessTerminateKill tests if terminating a process ignoring SIGTERM kills it after the grace period. The test succeeds if Terminate returns within 1 second given a grace period of 100 milliseconds.
+func TestProcessTerminateKill(t *testing.T) {
+	p, err := New([]string{"bash", "-c", "trap '' TERM && sleep 10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Terminate(100 * time.Millisecond)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The process did not terminate after 1 second.")
+	}
+	if !p.IntentionallyStopped() {
+		t.Fatal("The killed process is not reported as intentionally stopped.")
+	}
+}
+
+// TestProcessNotIntentionallyStopped tests if a process exiting on its own is not reported as intentionally stopped. The test succeeds if the exited process is not reported as intentionally stopped and terminating it afterwards has no effect.
+func TestProcessNotIntentionallyStopped(t *testing.T) {
+	p, err := New([]string{"true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	Drain(p.Stdout())
+	for p.ProcessState() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	err = p.Terminate(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.IntentionallyStopped() {
+		t.Fatal("The exited process is reported as intentionally stopped.")
+	}
+}
+
+// TestProcessScannerBuffer tests if the scanner buffers grow up to the configured maximum and the high-water mark is tracked. The test succeeds if a line longer than the initial buffer size is received completely and the high-water mark covers its length.
+func TestProcessScannerBuffer(t *testing.T) {
+	p, err := New([]string{"bash", "-c", "head -c 10000 /dev/zero | tr '\\0' x && echo"}, WithScannerBuffer(16, 1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdoutMessages [][]byte
+	for msg := range p.Stdout() {
+		stdoutMessages = append(stdoutMessages, msg)
+	}
+	if len(stdoutMessages) != 1 || len(stdoutMessages[0]) != 10000 {
+		t.Fatalf("Got %d messages, expected one message of %d bytes.", len(stdoutMessages), 10000)
+	}
+	stdout, stderr := p.BufferHighWater()
+	if stdout < 10000 {
+		t.Fatalf("The stdout high-water mark is %d, expected at least %d.", stdout, 10000)
+	}
+	if stderr != 0 {
+		t.Fatalf("The stderr high-water mark is %d, expected %d.", stderr, 0)
+	}
+}
+
+// TestProcessLines tests if the lines of stdout and stderr are delivered on a single channel with their streams and sequence numbers. The test succeeds if the lines written alternately to stdout and stderr are received in order with increasing sequence numbers and the channel gets closed.
+func TestProcessLines(t *testing.T) {
+	p, err := New([]string{"bash", "-c", "echo a && sleep 0.1 && echo b >&2 && sleep 0.1 && echo c"}, WithLines())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Stdout() != nil || p.Stderr() != nil {
+		t.Fatal("The stdout- and stderr-channels are available although the lines are merged.")
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Line{
+		{Seq: 1, Stream: StreamStdout, Data: []byte("a")},
+		{Seq: 2, Stream: StreamStderr, Data: []byte("b")},
+		{Seq: 3, Stream: StreamStdout, Data: []byte("c")},
+	}
+	var lines []Line
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case line, ok := <-p.Lines():
+			if ok {
+				lines = append(lines, line)
+				continue
+			}
+		case <-timeout:
+			t.Fatal("The lines-channel has not been closed after 1 second.")
+		}
+		break
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("Got %d lines, expected %d lines.", len(lines), len(expected))
+	}
+	for i := range expected {
+		if lines[i].Seq != expected[i].Seq || lines[i].Stream != expected[i].Stream || !bytes.Equal(lines[i].Data, expected[i].Data) {
+			t.Fatalf("Got line %+v, expected %+v.", lines[i], expected[i])
+		}
+	}
+}
+
+// TestProcessKill tests if killing a process stops it immediately even if a write to its stdin-pipe is pending. The process never reads its stdin, so the pipe fills up. The test succeeds if Kill returns within 1 second and the process is reported as intentionally stopped.
+func TestProcessKill(t *testing.T) {
+	p, err := New([]string{"sleep", "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		message := bytes.Repeat([]byte("x"), 1<<20)
+		p.Stdin() <- message
+		close(p.Stdin())
+	}()
+	done := make(chan error, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		done <- p.Kill()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The process has not been killed after 1 second.")
+	}
+	if !p.IntentionallyStopped() {
+		t.Fatal("The killed process is not reported as intentionally stopped.")
+	}
+}
+
+// TestProcessResourceUsage tests if the resource usage of an exited process is reported. The test succeeds if the resource usage is unavailable before the exit and the process busy for a moment reports a positive CPU time and maximum resident set size after the exit.
+func TestProcessResourceUsage(t *testing.T) {
+	p, err := New([]string{"bash", "-c", "for i in $(seq 100000); do :; done"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.MaxRSS() != 0 || p.UserTime() != 0 || p.SystemTime() != 0 {
+		t.Fatal("The resource usage is reported before the process exited.")
+	}
+	Drain(p.Stdout())
+	for p.ProcessState() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if p.UserTime()+p.SystemTime() <= 0 {
+		t.Fatalf("The process consumed %v of CPU time, expected a positive duration.", p.UserTime()+p.SystemTime())
+	}
+	if p.MaxRSS() <= 0 {
+		t.Fatalf("The process had a maximum resident set size of %d bytes, expected a positive size.", p.MaxRSS())
+	}
+}
+
+// TestProcessContext tests if cancelling the context terminates the process. The test succeeds if the process terminates within 1 second after the cancellation and is reported as intentionally stopped.
+func TestProcessContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p, err := New([]string{"sleep", "10"}, WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case <-p.done:
+	case <-time.After(time.Second):
+		t.Fatal("After cancelling the context, the process did not terminate after 1 second.")
+	}
+	if !p.IntentionallyStopped() {
+		t.Fatal("The terminated process is not reported as intentionally stopped.")
+	}
+	p, err = New([]string{"sleep", "10"}, WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Start() != context.Canceled {
+		t.Fatal("Starting the process with a cancelled context did not fail.")
+	}
+}
+
+// TestProcessStopChannel tests if closing the stop-channel terminates the process even if a context is given as well. The test succeeds if the process terminates within 1 second after closing the stop-channel.
+func TestProcessStopChannel(t *testing.T) {
+	stop := make(chan struct{})
+	p, err := New([]string{"sleep", "10"}, WithContext(context.Background()), WithStopChannel(stop), WithGracePeriod(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(stop)
+	select {
+	case <-p.done:
+	case <-time.After(time.Second):
+		t.Fatal("After closing the stop-channel, the process did not terminate after 1 second.")
+	}
+	if !p.IntentionallyStopped() {
+		t.Fatal("The terminated process is not reported as intentionally stopped.")
+	}
+}
+
+// TestProcessWait tests if the result of waiting for the process is observable. The test succeeds if Wait reports the unsuccessful exit of the process and the exited process has been reaped, i.e. no zombie remains, without consuming any output.
+func TestProcessWait(t *testing.T) {
+	p, err := New([]string{"bash", "-c", "echo Test && exit 3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Wait() != ErrNotStarted {
+		t.Fatal("Waiting for a process which has not been started did not fail.")
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-p.Done():
+	case <-time.After(time.Second):
+		t.Fatal("The process did not exit after 1 second.")
+	}
+	exitErr, ok := p.Wait().(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != 3 {
+		t.Fatalf("Waiting returned %v, expected exit status 3.", p.Wait())
+	}
+	if err := syscall.Kill(p.Cmd().Process.Pid, 0); err != syscall.ESRCH {
+		t.Fatalf("Probing the exited process returned %v, expected %v (no zombie).", err, syscall.ESRCH)
+	}
+}
+
+// TestProcessStartErrors tests if failures to start a process are classified. The test succeeds if a missing executable is reported as ErrNotFound and a file without execute permission as ErrPermission, both still wrapping the original error.
+func TestProcessStartErrors(t *testing.T) {
+	p, err := New([]string{"goprocess-does-not-exist"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if !errors.Is(err, ErrNotFound) || !errors.Is(err, exec.ErrNotFound) {
+		t.Fatalf("Starting a missing executable returned %v, expected %v.", err, ErrNotFound)
+	}
+	file, err := os.CreateTemp(t.TempDir(), "goprocess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	p, err = New([]string{file.Name()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	var pathErr *os.PathError
+	if !errors.Is(err, ErrPermission) || !errors.As(err, &pathErr) {
+		t.Fatalf("Starting a file without execute permission returned %v, expected %v.", err, ErrPermission)
+	}
+}
+
+// TestProcessStartErrorsExec tests if failures to execute an executable are classified. The test succeeds if a file without executable format is reported as ErrExecFormat and an executable opened for writing as ErrBinaryBusy, both still wrapping the original error.
+func TestProcessStartErrorsExec(t *testing.T) {
+	name := t.TempDir() + "/goprocess"
+	err := os.WriteFile(name, []byte{0, 1, 2, 3}, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := New([]string{name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if !errors.Is(err, ErrExecFormat) || !errors.Is(err, syscall.ENOEXEC) {
+		t.Fatalf("Starting a file without executable format returned %v, expected %v.", err, ErrExecFormat)
+	}
+	file, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	p, err = New([]string{name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if !errors.Is(err, ErrBinaryBusy) || !errors.Is(err, syscall.ETXTBSY) {
+		t.Fatalf("Starting an executable opened for writing returned %v, expected %v.", err, ErrBinaryBusy)
+	}
+}
+
+// TestProcessTrimCR tests if trailing carriage returns are stripped from the lines. The test succeeds if the lines written with multiple carriage returns in front of the newlines are received without any carriage return.
+func TestProcessTrimCR(t *testing.T) {
+	p, err := New([]string{"printf", "a\\r\\r\\nb\\r\\n\\r\\r\\n"}, WithTrimCR())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdoutMessages []string
+	for msg := range p.Stdout() {
+		stdoutMessages = append(stdoutMessages, string(msg))
+	}
+	expected := []string{"a", "b", ""}
+	if strings.Join(stdoutMessages, ",") != strings.Join(expected, ",") || len(stdoutMessages) != len(expected) {
+		t.Fatalf("Process send %q to stdout, expected %q.", stdoutMessages, expected)
+	}
+}
+
+// TestProcessRecv tests if lines can be received with a timeout. The test succeeds if a line of the process is received, receiving the next line times out while the process sleeps and the closed channel is reported after the process exited.
+func TestProcessRecv(t *testing.T) {
+	p, err := New([]string{"bash", "-c", "echo Test && sleep 0.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	line, ok, err := p.RecvStdout(ctx)
+	if err != nil || !ok || string(line) != "Test" {
+		t.Fatalf("Received %q, %v, %v, expected %q, %v, %v.", line, ok, err, "Test", true, nil)
+	}
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer shortCancel()
+	line, ok, err = p.RecvStdout(shortCtx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Received %q, %v, %v, expected error %v.", line, ok, err, context.DeadlineExceeded)
+	}
+	line, ok, err = p.RecvStdout(ctx)
+	if err != nil || ok {
+		t.Fatalf("Received %q, %v, %v, expected the closed channel.", line, ok, err)
+	}
+}
+
+// TestProcessPath tests if the executable can be set independently of argv[0]. The process prints its own command line. The test succeeds if the process has been launched from the given executable with the given argv[0].
+func TestProcessPath(t *testing.T) {
+	p, err := New([]string{"custom-name", "/proc/self/cmdline"}, WithPath("cat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout []byte
+	for msg := range p.Stdout() {
+		stdout = append(stdout, msg...)
+	}
+	expected := "custom-name\x00/proc/self/cmdline\x00"
+	if string(stdout) != expected {
+		t.Fatalf("Process has the command line %q, expected %q.", stdout, expected)
+	}
+}
+
+// TestProcessEnvFunc tests if the environment is computed when the process is started. The test succeeds if the process prints the value of the variable as computed at the start and inherits the other variables.
+func TestProcessEnvFunc(t *testing.T) {
+	value := "before"
+	p, err := New([]string{"bash", "-c", "echo $GOPROCESS_TEST && echo $HOME"}, WithEnvFunc(func() map[string]string {
+		return map[string]string{"GOPROCESS_TEST": value}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value = "after"
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdoutMessages []string
+	for msg := range p.Stdout() {
+		stdoutMessages = append(stdoutMessages, string(msg))
+	}
+	expected := []string{"after", os.Getenv("HOME")}
+	if strings.Join(stdoutMessages, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Process send %q to stdout, expected %q.", stdoutMessages, expected)
+	}
+}
+
+// TestProcessStderrDebounce tests if a flood of stderr lines is limited and summarized. The test succeeds if only the allowed number of lines is delivered per window, followed by a summary of the suppressed lines.
+func TestProcessStderrDebounce(t *testing.T) {
+	p, err := New([]string{"bash", "-c", "seq 100 >&2 && sleep 0.5 && echo last >&2"}, WithStderrDebounce(200*time.Millisecond, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stderrMessages []string
+	for msg := range p.Stderr() {
+		stderrMessages = append(stderrMessages, string(msg))
+	}
+	if len(stderrMessages) != 12 {
+		t.Fatalf("Got %d messages, expected %d messages.", len(stderrMessages), 12)
+	}
+	for i := 0; i < 10; i++ {
+		if stderrMessages[i] != strconv.Itoa(i+1) {
+			t.Fatalf("Message %d is %q, expected %q.", i, stderrMessages[i], strconv.Itoa(i+1))
+		}
+	}
+	if stderrMessages[10] != SummaryPrefix+"90 lines suppressed" {
+		t.Fatalf("Message %d is %q, expected %q.", 10, stderrMessages[10], SummaryPrefix+"90 lines suppressed")
+	}
+	if stderrMessages[11] != "last" {
+		t.Fatalf("Message %d is %q, expected %q.", 11, stderrMessages[11], "last")
+	}
+}
+
+// TestProcessStderrCoalesce tests if consecutive duplicate stderr lines are suppressed and summarized. The test succeeds if the repeats are summarized when a different line arrives and when stderr ends.
+func TestProcessStderrCoalesce(t *testing.T) {
+	p, err := New([]string{"sh", "-c", "echo a >&2; echo a >&2; echo a >&2; echo b >&2; echo c >&2; echo c >&2"}, WithStderrCoalesce(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stderrMessages []string
+	for msg := range p.Stderr() {
+		stderrMessages = append(stderrMessages, string(msg))
+	}
+	expected := []string{"a", SummaryPrefix + "last message repeated 2 times", "b", "c", SummaryPrefix + "last message repeated 1 times"}
+	if !reflect.DeepEqual(stderrMessages, expected) {
+		t.Fatalf("Got messages %q, expected %q.", stderrMessages, expected)
+	}
+}
+
+// TestProcessStdinAudit tests if everything sent to stdin is written to the audit writer after being redacted. The test succeeds if the audit writer received the redacted messages including the newlines and the process received the unredacted messages.
+func TestProcessStdinAudit(t *testing.T) {
+	var audit bytes.Buffer
+	redactor := func(data []byte) []byte {
+		return bytes.ReplaceAll(data, []byte("secret"), []byte("***"))
+	}
+	p, err := New([]string{"cat"}, WithStdinAudit(&audit), WithRedactor(redactor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Stdin() <- []byte("a")
+	p.Stdin() <- []byte("b secret")
+	close(p.Stdin())
+	var stdoutMessages []string
+	for msg := range p.Stdout() {
+		stdoutMessages = append(stdoutMessages, string(msg))
+	}
+	if strings.Join(stdoutMessages, "\n") != "a\nb secret" {
+		t.Fatalf("Process send %q to stdout, expected %q.", stdoutMessages, []string{"a", "b secret"})
+	}
+	if audit.String() != "a\nb ***\n" {
+		t.Fatalf("The audit writer received %q, expected %q.", audit.String(), "a\nb ***\n")
+	}
+}
+
+// BenchmarkRecvStdout measures the throughput of receiving many tiny lines from stdout.
+func BenchmarkRecvStdout(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p, err := New([]string{"bash", "-c", "yes | head -n 1000000"})
+		if err != nil {
+			b.Fatal(err)
+		}
+		err = p.Start()
+		if err != nil {
+			b.Fatal(err)
+		}
+		DrainAll(p)
+	}
+}
+
+// TestProcessAppendArgs tests if arguments can be appended before the process is started only. The test succeeds if the process receives the appended arguments and appending fails after the start.
+func TestProcessAppendArgs(t *testing.T) {
+	p, err := New([]string{"echo", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.AppendArgs("b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.AppendArgs("d") != ErrAlreadyStarted {
+		t.Fatal("Appending arguments after the start did not fail.")
+	}
+	msg := <-p.Stdout()
+	if string(msg) != "a b c" {
+		t.Fatalf("Process send %q to stdout, expected %q.", msg, "a b c")
+	}
+}
+
+// TestProcessSignalPid tests if a single member of the process group can be signaled. The process starts a descendant and waits for it. The test succeeds if a pid outside of the process group is rejected and signaling the descendant lets the process exit.
+func TestProcessSignalPid(t *testing.T) {
+	p, err := New([]string{"bash", "-c", "sleep 10 & echo $! && wait"}, WithProcessGroup(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Kill()
+	pid, err := strconv.Atoi(string(<-p.Stdout()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.SignalPid(os.Getpid(), syscall.SIGTERM)
+	if !errors.Is(err, ErrNotInProcessGroup) {
+		t.Fatalf("Signaling a pid outside of the process group returned %v, expected %v.", err, ErrNotInProcessGroup)
+	}
+	err = p.SignalPid(pid, syscall.SIGTERM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-p.Done():
+	case <-time.After(time.Second):
+		t.Fatal("The process has not exited after 1 second.")
+	}
+}
+
+// TestProcessWaitStdinConsumed tests if waiting for the consumption of stdin returns once the sentinel has been read. The process echoes its input, prints the sentinel at the end of its input and keeps running. The test succeeds if WaitStdinConsumed returns without error within 1 second.
+func TestProcessWaitStdinConsumed(t *testing.T) {
+	p, err := New([]string{"sh", "-c", "cat; echo done; sleep 10"}, WithConsumedSentinel([]byte("done")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Kill()
+	go func() {
+		for range p.Stdout() {
+		}
+	}()
+	p.Stdin() <- []byte("a")
+	close(p.Stdin())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = p.WaitStdinConsumed(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestProcessKillTree tests if killing the process tree reaches descendants without a process group. The process starts two descendants. The test succeeds if KillTree returns within 1 second and both descendants are dead afterwards.
+func TestProcessKillTree(t *testing.T) {
+	p, err := New([]string{"bash", "-c", "sleep 10 & sleep 10 & echo started && wait"}, WithProcessGroup(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-p.Stdout()
+	tree, err := processTree(p.Cmd().Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree) != 3 {
+		t.Fatalf("The process tree consists of %d processes, expected %d.", len(tree), 3)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- p.KillTree()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The process tree has not been killed after 1 second.")
+	}
+	for _, pid := range tree[1:] {
+		deadline := time.Now().Add(time.Second)
+		for processAlive(pid) {
+			if time.Now().After(deadline) {
+				t.Fatalf("The descendant %d is still alive after 1 second.", pid)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// processAlive returns whether the process exists and is not a zombie (orphans may not be reaped in containers).
+func processAlive(pid int) bool {
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return fields[0] != "Z"
+}
+
+// TestProcessStdinPrologue tests if the prologue and the epilogue enclose the messages sent to stdin. The test succeeds if the process receives the prologue first and the epilogue last.
+func TestProcessStdinPrologue(t *testing.T) {
+	p, err := New([]string{"cat"}, WithStdinPrologue([]byte("hello\n")), WithStdinEpilogue([]byte("bye\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Stdin() <- []byte("Test")
+	close(p.Stdin())
+	var stdoutMessages []string
+	for msg := range p.Stdout() {
+		stdoutMessages = append(stdoutMessages, string(msg))
+	}
+	expected := []string{"hello", "Test", "bye"}
+	if strings.Join(stdoutMessages, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Process send %q to stdout, expected %q.", stdoutMessages, expected)
+	}
+}
+
+// latin1Decoder transcodes Latin-1 to UTF-8.
+type latin1Decoder struct{}
+
+func (latin1Decoder) Bytes(b []byte) ([]byte, error) {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return []byte(string(runes)), nil
+}
+
+// TestProcessOutputEncoding tests if the output is transcoded to UTF-8 and invalid UTF-8 is dropped. The test succeeds if a Latin-1 line is received as UTF-8 and invalid UTF-8 is removed from a line.
+func TestProcessOutputEncoding(t *testing.T) {
+	p, err := New([]string{"printf", "caf\\xe9"}, WithOutputEncoding(latin1Decoder{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := <-p.Stdout()
+	if string(msg) != "café" {
+		t.Fatalf("Process send %q to stdout, expected %q.", msg, "café")
+	}
+	p, err = New([]string{"printf", "caf\\xe9"}, WithDropInvalidUTF8())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg = <-p.Stdout()
+	if string(msg) != "caf" {
+		t.Fatalf("Process send %q to stdout, expected %q.", msg, "caf")
+	}
+}
+
+// TestProcessOutputsClosed tests if the closing of both output channels is signaled. The test succeeds if the signal arrives within 1 second after the process terminated and both channels are closed at that time.
+func TestProcessOutputsClosed(t *testing.T) {
+	p, err := New([]string{"echo", "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-p.OutputsClosed():
+	case <-time.After(time.Second):
+		t.Fatal("The output channels have not been closed after 1 second.")
+	}
+	if msg, ok := <-p.Stdout(); !ok || string(msg) != "Test" {
+		t.Fatalf("Process send %q to stdout, expected %q.", msg, "Test")
+	}
+	if _, ok := <-p.Stdout(); ok {
+		t.Fatal("The stdout-channel is not closed.")
+	}
+	if _, ok := <-p.Stderr(); ok {
+		t.Fatal("The stderr-channel is not closed.")
+	}
+}
+
+// TestProcessWriteLine tests if messages written synchronously are interleaved correctly with messages of the stdin-channel. The test succeeds if the process receives all messages in order and writing after closing the stdin-channel fails with ErrStdinClosed.
+func TestProcessWriteLine(t *testing.T) {
+	p, err := New([]string{"cat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.WriteLine([]byte("a")) != ErrNotStarted {
+		t.Fatal("Writing to a process which has not been started did not fail.")
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Stdin() <- []byte("a")
+	err = p.WriteLine([]byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Stdin() <- []byte("c")
+	close(p.Stdin())
+	var stdoutMessages []string
+	for msg := range p.Stdout() {
+		stdoutMessages = append(stdoutMessages, string(msg))
+	}
+	expected := []string{"a", "b", "c"}
+	if strings.Join(stdoutMessages, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Process send %q to stdout, expected %q.", stdoutMessages, expected)
+	}
+	if p.WriteLine([]byte("d")) != ErrStdinClosed {
+		t.Fatal("Writing after closing the stdin-channel did not fail.")
+	}
+}
+
+// TestProcessOutStream tests if the output can be consumed via the stream helpers. The test succeeds if the lines are iterated until the break, the remaining lines are collected and the stderr-channel is consumed completely.
+func TestProcessOutStream(t *testing.T) {
+	p, err := New([]string{"bash", "-c", "seq 3 && echo Test >&2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first []byte
+	for line := range p.StdoutStream().Lines() {
+		first = line
+		break
+	}
+	if string(first) != "1" {
+		t.Fatalf("Iterated %q, expected %q.", first, "1")
+	}
+	rest := p.StdoutStream().Collect()
+	if len(rest) != 2 || string(rest[0]) != "2" || string(rest[1]) != "3" {
+		t.Fatalf("Collected %q, expected %q.", rest, []string{"2", "3"})
+	}
+	var stderrMessages []string
+	p.StderrStream().ForEach(func(line []byte) {
+		stderrMessages = append(stderrMessages, string(line))
+	})
+	if len(stderrMessages) != 1 || stderrMessages[0] != "Test" {
+		t.Fatalf("Process send %q to stderr, expected %q.", stderrMessages, []string{"Test"})
+	}
+}
+
+// TestProcessSeqBreak tests the policies applied when breaking out of a loop over the output. The process prints more lines than the channel buffers and exits. The test succeeds if the process exits within 1 second after the break when the output is drained and is intentionally stopped when it gets terminated.
+func TestProcessSeqBreak(t *testing.T) {
+	p, err := New([]string{"seq", "100000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range p.StdoutSeq() {
+		break
+	}
+	select {
+	case <-p.OutputsClosed():
+	case <-time.After(time.Second):
+		t.Fatal("After the break, the output has not been drained after 1 second.")
+	}
+	p, err = New([]string{"bash", "-c", "seq 10 && sleep 10"}, WithBreakPolicy(BreakTerminate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range p.StdoutSeq() {
+		break
+	}
+	select {
+	case <-p.Done():
+	case <-time.After(time.Second):
+		t.Fatal("After the break, the process did not terminate after 1 second.")
+	}
+	if !p.IntentionallyStopped() {
+		t.Fatal("The terminated process is not reported as intentionally stopped.")
+	}
+}
+
+// TestProcessSignalTarget tests if signals address the process group only if the process actually leads one. The test succeeds if the process started with a process group is signaled via its group and the process started without a process group is signaled directly.
+func TestProcessSignalTarget(t *testing.T) {
+	p, err := New([]string{"sleep", "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Kill()
+	pid := p.Cmd().Process.Pid
+	if !leadsProcessGroup(pid) {
+		t.Fatal("The process does not lead a process group of its own.")
+	}
+	if p.signalTarget() != -pid {
+		t.Fatalf("The signal target is %d, expected the process group %d.", p.signalTarget(), -pid)
+	}
+	p, err = New([]string{"sleep", "10"}, WithProcessGroup(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Kill()
+	pid = p.Cmd().Process.Pid
+	if leadsProcessGroup(pid) {
+		t.Fatal("The process leads a process group of its own.")
+	}
+	if p.signalTarget() != pid {
+		t.Fatalf("The signal target is %d, expected the process %d.", p.signalTarget(), pid)
+	}
+}
+
+// TestProcessStdinOpen tests if the state of the stdin-pipe is reported. The test succeeds if the stdin-pipe is reported closed before the start, open while the process runs and closed after closing the stdin-channel.
+func TestProcessStdinOpen(t *testing.T) {
+	p, err := New([]string{"cat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.StdinOpen() {
+		t.Fatal("The stdin-pipe is reported open before the start.")
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.StdinOpen() {
+		t.Fatal("The stdin-pipe is reported closed while the process runs.")
+	}
+	close(p.Stdin())
+	<-p.Done()
+	if p.StdinOpen() {
+		t.Fatal("The stdin-pipe is reported open after closing the stdin-channel.")
+	}
+}
+
+// TestProcessWithoutReaping tests if the exit is detected by the end of the output when reaping is disabled. The test succeeds if the process is signaled done after its output has been consumed, it has not been reaped and it can be reaped by the caller.
+func TestProcessWithoutReaping(t *testing.T) {
+	p, err := New([]string{"echo", "Test"}, WithReaping(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	DrainAll(p)
+	select {
+	case <-p.Done():
+	case <-time.After(time.Second):
+		t.Fatal("The process is not done after 1 second.")
+	}
+	if p.Wait() != nil || p.ProcessState() != nil {
+		t.Fatal("The process has been reaped by the package.")
+	}
+	state, err := p.Cmd().Process.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Success() {
+		t.Fatalf("The process exited with %v, expected success.", state)
+	}
+}
+
+// TestProcessOutputFunc tests if the output is passed to callbacks instead of channels. The test succeeds if no channels are created and the callbacks received the lines of stdout and stderr after the output ended.
+func TestProcessOutputFunc(t *testing.T) {
+	var stdoutMessages, stderrMessages []string
+	p, err := New([]string{"bash", "-c", "echo a && echo b >&2 && echo c"}, WithStdoutFunc(func(line []byte) {
+		stdoutMessages = append(stdoutMessages, string(line))
+	}), WithStderrFunc(func(line []byte) {
+		stderrMessages = append(stderrMessages, string(line))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Stdout() != nil || p.Stderr() != nil {
+		t.Fatal("The stdout- and stderr-channels are available although callbacks are given.")
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-p.OutputsClosed()
+	if strings.Join(stdoutMessages, ",") != "a,c" || strings.Join(stderrMessages, ",") != "b" {
+		t.Fatalf("The callbacks received %q and %q, expected %q and %q.", stdoutMessages, stderrMessages, []string{"a", "c"}, []string{"b"})
+	}
+}
+
+// TestProcessStartTimeout tests if a start which does not complete in time fails. The timeout is too short for any start to complete. The test succeeds if the start fails with ErrStartTimeout and the process has not been started.
+func TestProcessStartTimeout(t *testing.T) {
+	p, err := New([]string{"sleep", "10"}, WithStartTimeout(time.Nanosecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if !errors.Is(err, ErrStartTimeout) || !errors.Is(err, ErrStart) {
+		t.Fatalf("Starting returned %v, expected %v.", err, ErrStartTimeout)
+	}
+	if p.Cmd() != nil {
+		t.Fatal("The process has been started although the start timed out.")
+	}
+}
+
+// TestProcessSkipEmptyLines tests if empty lines are dropped. The test succeeds if neither the empty line nor the line becoming empty by trimming the carriage return is received.
+func TestProcessSkipEmptyLines(t *testing.T) {
+	p, err := New([]string{"printf", "a\\n\\n\\r\\r\\nb\\n"}, WithSkipEmptyLines(true), WithTrimCR())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdoutMessages []string
+	for msg := range p.Stdout() {
+		stdoutMessages = append(stdoutMessages, string(msg))
+	}
+	expected := []string{"a", "b"}
+	if strings.Join(stdoutMessages, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Process send %q to stdout, expected %q.", stdoutMessages, expected)
+	}
+}
+
+// TestProcessShell tests if the process is run by a login shell with its arguments passed literally. The test succeeds if the process prints its arguments without any expansion and the shell is invoked with -lc.
+func TestProcessShell(t *testing.T) {
+	p, err := New([]string{"echo", "$HOME", "it's", "*"}, WithShell("/bin/bash", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := <-p.Stdout()
+	if string(msg) != "$HOME it's *" {
+		t.Fatalf("Process send %q to stdout, expected %q.", msg, "$HOME it's *")
+	}
+	args := p.Cmd().Args
+	if len(args) != 3 || args[1] != "-lc" || args[2] != `exec 'echo' '$HOME' 'it'\''s' '*'` {
+		t.Fatalf("Process is run by %q, expected a login shell with the quoted arguments.", args)
+	}
+}
+
+// TestProcessExit tests if the exit status is sent on the exit channel. The test succeeds if the exit code of a process exiting by itself and the signal of a killed process are reported, including the raw wait status.
+func TestProcessExit(t *testing.T) {
+	p, err := StartProcess([]string{"sh", "-c", "exit 3"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := <-p.Exit()
+	if status.Code != 3 || status.Signal != nil {
+		t.Fatalf("Process exited with %+v, expected exit code 3.", status)
+	}
+	p, err = StartProcess([]string{"sh", "-c", "kill -TERM $$"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status = <-p.Exit()
+	if status.Code != -1 || status.Signal != syscall.SIGTERM {
+		t.Fatalf("Process exited with %+v, expected to be terminated by SIGTERM.", status)
+	}
+	waitStatus, ok := status.WaitStatus()
+	if !ok || !waitStatus.Signaled() || waitStatus.Signal() != syscall.SIGTERM {
+		t.Fatalf("Process exited with wait status %v, expected to be terminated by SIGTERM.", waitStatus)
+	}
+	if _, ok := <-p.Exit(); ok {
+		t.Fatal("The exit channel is not closed after sending the exit status.")
+	}
+}
+
+// flakyWriter fails with the given error for the first failures writes.
+type flakyWriter struct {
+	failures int
+	err      error
+	bytes.Buffer
+}
+
+func (w *flakyWriter) Write(data []byte) (int, error) {
+	if w.failures > 0 {
+		w.failures--
+		return 0, w.err
+	}
+	return w.Buffer.Write(data)
+}
+
+// TestProcessStdinRetry tests if transient write errors of stdin are retried. The test succeeds if a write failing with EAGAIN is retried until it succeeds, a write failing with EPIPE is not retried and a failed write of the stdin-channel is reported on the error channel.
+func TestProcessStdinRetry(t *testing.T) {
+	p, err := New([]string{"cat"}, WithStdinRetry(3, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := &flakyWriter{failures: 2, err: syscall.EAGAIN}
+	err = p.writeLine(writer, []byte("foo"))
+	if err != nil || writer.String() != "foo\n" {
+		t.Fatalf("Writing with transient errors resulted in %q (%v), expected %q.", writer.String(), err, "foo\n")
+	}
+	writer = &flakyWriter{failures: 1, err: syscall.EPIPE}
+	err = p.writeLine(writer, []byte("foo"))
+	if !errors.Is(err, syscall.EPIPE) || writer.Len() != 0 {
+		t.Fatalf("Writing with EPIPE resulted in %q (%v), expected no retry.", writer.String(), err)
+	}
+
+	stdin := make(chan []byte)
+	p, err = StartProcess([]string{"true"}, stdin, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-p.Done()
+	stdin <- []byte("foo")
+	err = <-p.Errors()
+	if !errors.Is(err, ErrStdinWrite) || !errors.Is(err, syscall.EPIPE) {
+		t.Fatalf("Process reported %v, expected a write error of stdin.", err)
+	}
+	close(stdin)
+}
+
+// TestProcessExecSpec tests if the specification of a process round-trips. The test succeeds if a process created from the serialized specification has the same specification and runs in the same directory with the same environment, and if the redacted specification masks the environment, and if the specification of a started process leaves out the color variables.
+func TestProcessExecSpec(t *testing.T) {
+	p, err := New([]string{"sh", "-c", "pwd; echo $FOO"}, WithDir("/"), WithEnv(map[string]string{"FOO": "secret"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(p.ExecSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec ExecSpec
+	err = json.Unmarshal(data, &spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewProcessFromSpec(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(q.ExecSpec(), p.ExecSpec()) {
+		t.Fatalf("Process created from spec has spec %+v, expected %+v.", q.ExecSpec(), p.ExecSpec())
+	}
+	err = q.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"/", "secret"} {
+		msg := <-q.Stdout()
+		if string(msg) != expected {
+			t.Fatalf("Process send %q to stdout, expected %q.", msg, expected)
+		}
+	}
+	redacted := spec.Redacted(func(data []byte) []byte {
+		return bytes.ReplaceAll(data, []byte("secret"), []byte("***"))
+	})
+	if redacted.Env["FOO"] != "***" || spec.Env["FOO"] != "secret" {
+		t.Fatalf("Redacted spec has env %v, expected the value to be masked.", redacted.Env)
+	}
+	colored, err := New([]string{"true"}, WithEnv(map[string]string{"FOO": "bar"}), WithNoColor())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = colored.Start(); err != nil {
+		t.Fatal(err)
+	}
+	<-colored.Done()
+	if env := colored.ExecSpec().Env; !reflect.DeepEqual(env, map[string]string{"FOO": "bar"}) {
+		t.Fatalf("Started process has spec env %v, expected only the variables of WithEnv.", env)
+	}
+}
+
+// TestMultiplexer tests if the output of multiple processes is merged. The test succeeds if all lines of all processes are received tagged with the name of their process and stream, and a process which exits early does not disrupt the others.
+func TestMultiplexer(t *testing.T) {
+	m := NewMultiplexer()
+	stdin := make(chan []byte)
+	long, err := StartProcess([]string{"cat"}, stdin, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Add("long", long)
+	short, err := StartProcess([]string{"sh", "-c", "echo foo; echo bar >&2"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Add("short", short)
+	received := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		line := <-m.Output()
+		received[line.Name+" "+line.Stream.String()+" "+string(line.Data)] = true
+	}
+	if !received["short stdout foo"] || !received["short stderr bar"] {
+		t.Fatalf("Multiplexer forwarded %v, expected the lines of the short process.", received)
+	}
+	<-short.Done()
+	stdin <- []byte("baz")
+	line := <-m.Output()
+	if line.Name != "long" || line.Stream != StreamStdout || string(line.Data) != "baz" {
+		t.Fatalf("Multiplexer forwarded %+v, expected the line of the long process.", line)
+	}
+	close(stdin)
+}
+
+// TestProcessStdinHeartbeat tests if heartbeats are written to stdin interleaved with the messages of the stdin-channel. The test succeeds if cat echoes both the heartbeats and the messages unchanged.
+func TestProcessStdinHeartbeat(t *testing.T) {
+	stdin := make(chan []byte)
+	p, err := StartProcess([]string{"cat"}, stdin, nil, WithStdinHeartbeat([]byte("ping"), 10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	heartbeats := 0
+	messages := 0
+	go func() {
+		for i := 0; i < 10; i++ {
+			stdin <- []byte(strings.Repeat("x", 10000))
+			time.Sleep(5 * time.Millisecond)
+		}
+		close(stdin)
+	}()
+	for msg := range p.Stdout() {
+		switch string(msg) {
+		case "ping":
+			heartbeats++
+		case strings.Repeat("x", 10000):
+			messages++
+		default:
+			t.Fatalf("Process send %d bytes to stdout, expected a heartbeat or a message.", len(msg))
+		}
+	}
+	if heartbeats == 0 || messages != 10 {
+		t.Fatalf("Process send %d heartbeats and %d messages, expected at least one heartbeat and 10 messages.", heartbeats, messages)
+	}
+}
+
+// TestProcessStartupSilenceTimeout tests if a silent process is terminated after the startup silence timeout. The test succeeds if a silent process is terminated and reported as failed startup, while a process printing a line in time keeps running after the timeout.
+func TestProcessStartupSilenceTimeout(t *testing.T) {
+	p, err := StartProcess([]string{"sleep", "10"}, nil, nil, WithStartupSilenceTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-p.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("The silent process has not been terminated.")
+	}
+	err = <-p.Errors()
+	if !p.StartupFailed() || !errors.Is(err, ErrStartupSilence) {
+		t.Fatalf("Process reported %v, expected a failed startup.", err)
+	}
+
+	p, err = StartProcess([]string{"sh", "-c", "echo ready; sleep 0.5"}, nil, nil, WithStartupSilenceTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-p.Stdout()
+	err = p.Wait()
+	if err != nil || p.StartupFailed() || p.IntentionallyStopped() {
+		t.Fatalf("Process exited with %v, expected to keep running after the first output.", err)
+	}
+}
+
+// countingPool is a pool of scanner buffers counting the allocated buffers.
+type countingPool struct {
+	mutex     sync.Mutex
+	buffers   []*[]byte
+	allocated int
+}
+
+func (p *countingPool) Get() any {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.buffers) == 0 {
+		p.allocated++
+		buffer := make([]byte, 0, 4096)
+		return &buffer
+	}
+	buffer := p.buffers[len(p.buffers)-1]
+	p.buffers = p.buffers[:len(p.buffers)-1]
+	return buffer
+}
+
+func (p *countingPool) Put(buffer any) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.buffers = append(p.buffers, buffer.(*[]byte))
+}
+
+// TestProcessScannerBufferPool tests if the scanner buffers are reused across processes. The test succeeds if restarted processes read their output correctly with at most the two buffers allocated by the first process.
+func TestProcessScannerBufferPool(t *testing.T) {
+	pool := &countingPool{}
+	for i := 0; i < 3; i++ {
+		p, err := StartProcess([]string{"seq", "1000"}, nil, nil, WithScannerBufferPool(pool))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := p.StdoutStream().Collect()
+		<-p.OutputsClosed()
+		if len(lines) != 1000 || string(lines[999]) != "1000" {
+			t.Fatalf("Process send %d lines to stdout, expected 1000.", len(lines))
+		}
+	}
+	if pool.allocated > 2 {
+		t.Fatalf("Pool allocated %d buffers, expected at most 2.", pool.allocated)
+	}
+}
+
+// TestProcessOpenFDs tests if the open file descriptors of the process are enumerated. The test succeeds if the process has its standard file descriptors open, the stdin being a pipe, and a file it opened itself.
+func TestProcessOpenFDs(t *testing.T) {
+	p, err := New([]string{"sh", "-c", "exec 5</dev/null; echo ready; exec cat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.OpenFDs()
+	if err != ErrNotStarted {
+		t.Fatalf("Enumerating the file descriptors before the start returned %v, expected %v.", err, ErrNotStarted)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-p.Stdout()
+	fds, err := p.OpenFDs()
+	if errors.Is(err, ErrNotSupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := map[int]string{}
+	for _, fd := range fds {
+		targets[fd.FD] = fd.Target
+	}
+	if !strings.HasPrefix(targets[0], "pipe:") || targets[1] == "" || targets[2] == "" || targets[5] != "/dev/null" {
+		t.Fatalf("Process has the file descriptors %v open, expected 0, 1, 2 and 5.", fds)
+	}
+	close(p.Stdin())
+	p.Wait()
+}
+
+// sigpipeIgnored returns whether SIGPIPE is ignored by a process started with the options, read from its status in /proc.
+func sigpipeIgnored(t *testing.T, opts ...Option) bool {
+	p, err := StartProcess([]string{"grep", "SigIgn", "/proc/self/status"}, nil, nil, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, ok := <-p.Stdout()
+	if !ok {
+		t.Skip("The signal dispositions cannot be read from /proc.")
+	}
+	mask, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(string(msg), "SigIgn:")), 16, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mask&(1<<(syscall.SIGPIPE-1)) != 0
+}
+
+// TestProcessResetSIGPIPE tests if the process is started with the default disposition of SIGPIPE although it is ignored by the parent. The test succeeds if SIGPIPE is ignored by a process started without the option, but not by a process started with it, and it stays ignored by the parent.
+func TestProcessResetSIGPIPE(t *testing.T) {
+	signal.Ignore(syscall.SIGPIPE)
+	defer signal.Reset(syscall.SIGPIPE)
+	if !sigpipeIgnored(t) {
+		t.Fatal("SIGPIPE is not ignored by the process started without the option.")
+	}
+	if sigpipeIgnored(t, WithResetSIGPIPE()) {
+		t.Fatal("SIGPIPE is ignored by the process started with the option.")
+	}
+	if !signal.Ignored(syscall.SIGPIPE) {
+		t.Fatal("SIGPIPE is not ignored by the parent anymore.")
+	}
+}
+
+// TestProcessStdinProgress tests if the progress of writing stdin is reported. The test succeeds if the reports are increasing, far fewer than the writes and the last report is the total number of bytes written.
+func TestProcessStdinProgress(t *testing.T) {
+	var mutex sync.Mutex
+	var reports []int64
+	stdin := make(chan []byte)
+	p, err := StartProcess([]string{"cat"}, stdin, nil, WithStdinProgress(func(written int64) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		reports = append(reports, written)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for i := 0; i < 10000; i++ {
+			stdin <- []byte(strings.Repeat("x", 999))
+		}
+		close(stdin)
+	}()
+	Drain(p.Stdout())
+	p.Wait()
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(reports) == 0 || len(reports) > 1000 || reports[len(reports)-1] != 10000*1000 {
+		t.Fatalf("Progress has been reported %d times ending with %v, expected fewer than 1000 reports ending with %d.", len(reports), reports[len(reports)-1:], 10000*1000)
+	}
+	for i := 1; i < len(reports); i++ {
+		if reports[i] < reports[i-1] {
+			t.Fatalf("Progress decreased from %d to %d.", reports[i-1], reports[i])
+		}
+	}
+}
+
+// TestProcessStreamFiles tests if the standard streams of the process can be connected to files directly. The test succeeds if the process reads stdin from a file and writes stdout to a file, the corresponding channels are nil, stderr is still delivered on its channel and conflicting options are rejected.
+func TestProcessStreamFiles(t *testing.T) {
+	dir := t.TempDir()
+	input, err := os.Create(dir + "/input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input.WriteString("foo\n")
+	input.Seek(0, 0)
+	defer input.Close()
+	output, err := os.Create(dir + "/output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	p, err := New([]string{"sh", "-c", "cat; echo bar >&2"}, WithStdinSource(input), WithStdoutTarget(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Stdin() != nil || p.Stdout() != nil {
+		t.Fatal("The channels of the streams connected to files are not nil.")
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := <-p.Stderr()
+	if string(msg) != "bar" {
+		t.Fatalf("Process send %q to stderr, expected %q.", msg, "bar")
+	}
+	err = p.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-p.OutputsClosed()
+	data, err := os.ReadFile(dir + "/output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "foo\n" {
+		t.Fatalf("Process wrote %q to the file, expected %q.", data, "foo\n")
+	}
+	if p.WriteLine([]byte("foo")) != ErrStdinClosed {
+		t.Fatal("Writing to stdin connected to a file does not fail.")
+	}
+	_, err = New([]string{"cat"}, WithStdoutTarget(output), WithStdoutFunc(func([]byte) {}))
+	if err == nil {
+		t.Fatal("Configuring stdout by both a file and a callback does not fail.")
+	}
+}
+
+// TestProcessSignalBeforeStart tests if signals sent before the start are forwarded after the start. The test succeeds if a signal in a buffered channel and a signal sent on the owned channel before the start terminate the processes without a panic.
+func TestProcessSignalBeforeStart(t *testing.T) {
+	signals := make(chan os.Signal, 1)
+	signals <- syscall.SIGTERM
+	p, err := New([]string{"sleep", "10"}, WithSignals(signals))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := <-p.Exit()
+	if status.Signal != syscall.SIGTERM {
+		t.Fatalf("Process exited with %+v, expected to be terminated by SIGTERM.", status)
+	}
+
+	p, err = New([]string{"sleep", "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := make(chan struct{})
+	go func() {
+		p.Signals() <- syscall.SIGTERM
+		close(sent)
+	}()
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-sent
+	status = <-p.Exit()
+	if status.Signal != syscall.SIGTERM {
+		t.Fatalf("Process exited with %+v, expected to be terminated by SIGTERM.", status)
+	}
+}
+
+// TestProcessLifetimeContext tests if the context of the process is cancelled when the process exits. The test succeeds if the context is not cancelled while the process runs and its cause carries the exit code after the exit.
+func TestProcessLifetimeContext(t *testing.T) {
+	stdin := make(chan []byte)
+	p, err := StartProcess([]string{"sh", "-c", "read line; exit 3"}, stdin, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := p.Context()
+	if ctx.Err() != nil {
+		t.Fatal("The context is cancelled while the process runs.")
+	}
+	close(stdin)
+	<-ctx.Done()
+	cause := context.Cause(ctx)
+	var exitErr *exec.ExitError
+	if !errors.Is(cause, ErrExited) || !errors.As(cause, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("The context has been cancelled with %v, expected the exit code 3.", cause)
+	}
+}
+
+// TestProcessKeepDelimiter tests if the delimiters of the lines are kept. The test succeeds if the lines including their delimiters equal the output, and with WithTrimCR and WithSkipEmptyLines the carriage returns and empty lines are removed while the newlines are kept.
+func TestProcessKeepDelimiter(t *testing.T) {
+	output := "foo\r\n\nbar\nbaz"
+	p, err := StartProcess([]string{"printf", output}, nil, nil, WithKeepDelimiter(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := p.StdoutStream().Collect()
+	if joined := string(bytes.Join(lines, nil)); joined != output || len(lines) != 4 {
+		t.Fatalf("Process send %q to stdout, expected %q.", lines, output)
+	}
+	p, err = StartProcess([]string{"printf", output}, nil, nil, WithKeepDelimiter(true), WithTrimCR(), WithSkipEmptyLines(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines = p.StdoutStream().Collect()
+	if joined := string(bytes.Join(lines, nil)); joined != "foo\nbar\nbaz" {
+		t.Fatalf("Process send %q to stdout, expected %q.", joined, "foo\nbar\nbaz")
+	}
+}
+
+// TestDrainAll tests if all output of a process is drained. The test succeeds if a process writing more than the pipes and channel buffers can hold to both stdout and stderr exits while its output is drained.
+func TestDrainAll(t *testing.T) {
+	p, err := StartProcess([]string{"sh", "-c", "seq 100000; seq 100000 >&2"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	DrainAll(p)
+	err = p.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	Drain(nil)
+}
+
+// TestProcessKiller tests if signals are sent by the custom killer. The test succeeds if Terminate passes SIGTERM for the process group to the killer, which actually delivers it.
+func TestProcessKiller(t *testing.T) {
+	var mutex sync.Mutex
+	var targets []int
+	p, err := StartProcess([]string{"sleep", "10"}, nil, nil, WithKiller(func(target int, signal syscall.Signal) error {
+		mutex.Lock()
+		targets = append(targets, target)
+		mutex.Unlock()
+		return syscall.Kill(target, signal)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Terminate(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(targets) != 1 || targets[0] != -p.Pid() {
+		t.Fatalf("The killer has been called for %v, expected the process group %d.", targets, p.Pid())
+	}
+}
+
+// TestProcessStdinDone tests if the completion of stdin is reported. The test succeeds if the stdin-done channel is open while the stdin-channel is open, and it is closed after closing the stdin-channel with all messages written.
+func TestProcessStdinDone(t *testing.T) {
+	stdin := make(chan []byte, 10)
+	p, err := StartProcess([]string{"cat"}, stdin, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		stdin <- []byte(strconv.Itoa(i))
+	}
+	select {
+	case <-p.StdinDone():
+		t.Fatal("The stdin-done channel is closed while the stdin-channel is open.")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(stdin)
+	<-p.StdinDone()
+	if p.StdinOpen() {
+		t.Fatal("Stdin is open after the stdin-done channel has been closed.")
+	}
+	lines := p.StdoutStream().Collect()
+	if len(lines) != 10 {
+		t.Fatalf("Process send %d lines to stdout, expected 10.", len(lines))
+	}
+}
+
+// TestProcessHeaderLine tests if the first line of stdout is delivered separately. The test succeeds if the header arrives on the header channel and the rows on the stdout-channel, and the header channel of a process without output is closed without a line.
+func TestProcessHeaderLine(t *testing.T) {
+	p, err := StartProcess([]string{"printf", "name,value\\na,1\\nb,2\\n"}, nil, nil, WithHeaderLine())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := p.StdoutStream().Collect()
+	header := <-p.Header()
+	if string(header) != "name,value" {
+		t.Fatalf("Process send the header %q, expected %q.", header, "name,value")
+	}
+	if len(rows) != 2 || string(rows[0]) != "a,1" || string(rows[1]) != "b,2" {
+		t.Fatalf("Process send the rows %q, expected %q.", rows, []string{"a,1", "b,2"})
+	}
+	p, err = StartProcess([]string{"true"}, nil, nil, WithHeaderLine())
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, ok := <-p.Header()
+	if ok {
+		t.Fatalf("Process send the header %q, expected none.", header)
+	}
+}
+
+// TestSupervisorRestartLimit tests if a crashing process is restarted until the restart limit is exceeded. The test succeeds if the output of all runs is forwarded, the number of restarts equals the limit and the supervisor gives up with ErrRestartLimit.
+func TestSupervisorRestartLimit(t *testing.T) {
+	s := NewSupervisor(func() (*Process, error) {
+		return New([]string{"sh", "-c", "echo run; exit 1"})
+	}, WithRestartLimit(3, time.Minute), WithRestartBackoff(time.Millisecond, time.Millisecond))
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := len(OutStream{C: s.Stdout()}.Collect())
+	<-s.Done()
+	if runs != 4 || s.Restarts() != 3 {
+		t.Fatalf("Process ran %d times with %d restarts, expected 4 runs and 3 restarts.", runs, s.Restarts())
+	}
+	if s.Err() != ErrRestartLimit || <-s.Errors() != ErrRestartLimit {
+		t.Fatalf("Supervisor gave up with %v, expected %v.", s.Err(), ErrRestartLimit)
+	}
+}
+
+// TestSupervisorRestartResources tests if the resources of exited processes are released. The process exits immediately and is restarted 50 times. The test succeeds if neither the number of goroutines nor the number of open files grows with the restarts.
+func TestSupervisorRestartResources(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	files := openFiles(t)
+	s := NewSupervisor(func() (*Process, error) {
+		return New([]string{"true"})
+	}, WithRestartLimit(50, time.Minute), WithRestartBackoff(time.Millisecond, time.Millisecond))
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go Drain(s.Stderr())
+	Drain(s.Stdout())
+	<-s.Done()
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > goroutines+5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines+5 {
+		t.Fatalf("%d goroutines are running after the restarts, expected about %d.", n, goroutines)
+	}
+	if n := openFiles(t); n > files+5 {
+		t.Fatalf("%d files are open after the restarts, expected about %d.", n, files)
+	}
+}
+
+// openFiles returns the number of open files of the test process. It skips the test if they cannot be listed.
+func openFiles(t *testing.T) int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("open files cannot be listed:", err)
+	}
+	return len(entries)
+}
+
+// TestSupervisorStop tests if a stopped supervisor terminates its process without restarting it. The test succeeds if the process is terminated, not restarted and the supervisor reports no error.
+func TestSupervisorStop(t *testing.T) {
+	s := NewSupervisor(func() (*Process, error) {
+		return New([]string{"sleep", "10"})
+	})
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := s.Process()
+	err = s.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.IntentionallyStopped() || s.Process() != p || s.Restarts() != 0 || s.Err() != nil {
+		t.Fatalf("Supervisor restarted %d times with %v, expected no restart and no error.", s.Restarts(), s.Err())
+	}
+}
+
+// TestSupervisorRestartHooks tests if the hooks are called around the restarts. The test succeeds if the pre-restart hook is called before and the post-restart hook after every restart with the number of the attempt.
+func TestSupervisorRestartHooks(t *testing.T) {
+	var events []string
+	s := NewSupervisor(func() (*Process, error) {
+		events = append(events, "start")
+		return New([]string{"true"})
+	}, WithRestartLimit(2, 0), WithRestartBackoff(time.Millisecond, time.Millisecond), WithPreRestart(func() {
+		events = append(events, "pre")
+	}), WithPostRestart(func(attempt int) {
+		events = append(events, "post "+strconv.Itoa(attempt))
+	}))
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-s.Done()
+	expected := []string{"start", "pre", "start", "post 1", "pre", "start", "post 2"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("Supervisor produced the events %q, expected %q.", events, expected)
+	}
+}
+
+// TestProcessRecentLines tests if the last lines of the output are retained. The test succeeds if the last lines are returned oldest first, limited by the size of the ring buffer and the number of lines written.
+func TestProcessRecentLines(t *testing.T) {
+	p, err := StartProcess([]string{"sh", "-c", "seq 10; echo error >&2"}, nil, nil, WithRecentLines(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	DrainAll(p)
+	if lines := p.RecentStdout(2); len(lines) != 2 || string(lines[0]) != "9" || string(lines[1]) != "10" {
+		t.Fatalf("Process retained %q, expected %q.", lines, []string{"9", "10"})
+	}
+	if lines := p.RecentStdout(5); len(lines) != 3 || string(lines[0]) != "8" {
+		t.Fatalf("Process retained %q, expected %q.", lines, []string{"8", "9", "10"})
+	}
+	if lines := p.RecentStderr(5); len(lines) != 1 || string(lines[0]) != "error" {
+		t.Fatalf("Process retained %q, expected %q.", lines, []string{"error"})
+	}
+}
+
+// TestProcessLinePrefix tests if the delivered lines are prefixed. The test succeeds if the lines of stdout and stderr arrive with the prefix on the merged channel.
+func TestProcessLinePrefix(t *testing.T) {
+	p, err := StartProcess([]string{"sh", "-c", "echo foo; echo bar >&2"}, nil, nil, WithLinePrefix([]byte("[tag] ")), WithLines())
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := map[string]bool{}
+	for line := range p.Lines() {
+		received[string(line.Data)] = true
+	}
+	if len(received) != 2 || !received["[tag] foo"] || !received["[tag] bar"] {
+		t.Fatalf("Process send %v, expected the prefixed lines.", received)
+	}
+}
+
+// TestProcessDetach tests if a detached process leads a session of its own. The test succeeds if the process leads a new session, its channels are nil and its pid is written to the pid file.
+func TestProcessDetach(t *testing.T) {
+	pidFile := t.TempDir() + "/pid"
+	p, err := New([]string{"sleep", "10"}, WithDetach(), WithPidFile(pidFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Kill()
+	if p.Stdin() != nil || p.Stdout() != nil || p.Stderr() != nil {
+		t.Fatal("The channels of the detached process are not nil.")
+	}
+	pid := strconv.Itoa(p.Pid())
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != pid+"\n" {
+		t.Fatalf("Pid file contains %q, expected %q.", data, pid+"\n")
+	}
+	stat, err := os.ReadFile("/proc/" + pid + "/stat")
+	if err != nil {
+		t.Skip(err)
+	}
+	// the fields after the command are state, ppid, pgrp and session
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	if fields[3] != pid {
+		t.Fatalf("Process is in session %s, expected its own session %s.", fields[3], pid)
+	}
+}
+
+// TestNewProcessWithOptions tests if the settings of Options are applied. The test succeeds if the process runs in the directory and with the environment of the Options, and a functional option takes precedence over the Options.
+func TestNewProcessWithOptions(t *testing.T) {
+	options := &Options{Dir: "/", Env: map[string]string{"FOO": "foo"}, SkipEmptyLines: true}
+	stdout, _, err := NewProcessWithOptions([]string{"sh", "-c", "pwd; echo; echo $FOO"}, options, nil, nil, WithDir("/tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := OutStream{C: stdout}.Collect()
+	if len(lines) != 2 || string(lines[0]) != "/tmp" || string(lines[1]) != "foo" {
+		t.Fatalf("Process send %q to stdout, expected %q.", lines, []string{"/tmp", "foo"})
+	}
+}
+
+// TestProcessWriteLineContext tests if a write to stdin is abandoned when its context is done. The test succeeds if the write of a message larger than the pipe returns the error of the context, stdin is closed and the process reads a truncated message.
+func TestProcessWriteLineContext(t *testing.T) {
+	p, err := StartProcess([]string{"sh", "-c", "sleep 0.5; wc -c"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = p.WriteLineContext(ctx, bytes.Repeat([]byte("x"), 1<<20))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Writing returned %v, expected %v.", err, context.DeadlineExceeded)
+	}
+	if p.StdinOpen() {
+		t.Fatal("Stdin is open after abandoning a write.")
+	}
+	msg := <-p.Stdout()
+	count, err := strconv.Atoi(strings.TrimSpace(string(msg)))
+	if err != nil || count <= 0 || count > 1<<20 {
+		t.Fatalf("Process read %q bytes, expected a truncated message.", msg)
+	}
+}
+
+// TestProcessStderrAsError tests if output on stderr turns a successful exit into an error. The test succeeds if a process exiting successfully after writing to stderr results in a StderrError with the line of stderr, while a process without output on stderr results in no error.
+func TestProcessStderrAsError(t *testing.T) {
+	p, err := StartProcess([]string{"sh", "-c", "echo warning >&2"}, nil, nil, WithStderrAsError())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Wait()
+	var stderrErr *StderrError
+	if !errors.As(err, &stderrErr) || len(stderrErr.Stderr) != 1 || string(stderrErr.Stderr[0]) != "warning" {
+		t.Fatalf("Process exited with %v, expected a stderr error with %q.", err, "warning")
+	}
+	p, err = StartProcess([]string{"true"}, nil, nil, WithStderrAsError())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Wait()
+	if err != nil {
+		t.Fatalf("Process exited with %v, expected no error.", err)
+	}
+}
+
+// TestProcessCombinedOutput tests if stdout and stderr are delivered in the exact order they have been written. The test succeeds if alternating lines written to stdout and stderr arrive in order on the stdout-channel and the stderr-channel is nil.
+func TestProcessCombinedOutput(t *testing.T) {
+	p, err := StartProcess([]string{"sh", "-c", "for i in $(seq 100); do echo $i; echo $i >&2; done"}, nil, nil, WithCombinedOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Stderr() != nil {
+		t.Fatal("The stderr-channel is not nil.")
+	}
+	lines := p.StdoutStream().Collect()
+	if len(lines) != 200 {
+		t.Fatalf("Process send %d lines to stdout, expected 200.", len(lines))
+	}
+	for i, line := range lines {
+		if expected := strconv.Itoa(i/2 + 1); string(line) != expected {
+			t.Fatalf("Process send %q as line %d, expected %q.", line, i, expected)
+		}
+	}
+}
+
+// TestProcessStopSequence tests if Terminate walks the stop sequence. The test succeeds if a process ignoring the first signal receives the second one of the sequence after its delay and exits.
+func TestProcessStopSequence(t *testing.T) {
+	p, err := StartProcess([]string{"sh", "-c", "trap 'echo usr1' USR1; echo ready; while true; do sleep 0.01; done"}, nil, nil, WithStopSequence([]StopStep{
+		{Signal: syscall.SIGUSR1},
+		{WaitBefore: 200 * time.Millisecond, Signal: syscall.SIGTERM},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-p.Stdout()
+	start := time.Now()
+	err = p.Terminate(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 5*time.Second {
+		t.Fatalf("Process exited after %v, expected after the delay of the second step.", elapsed)
+	}
+	msg := <-p.Stdout()
+	status := <-p.Exit()
+	if string(msg) != "usr1" || status.Signal != syscall.SIGTERM {
+		t.Fatalf("Process send %q and exited with %+v, expected to receive both signals.", msg, status)
+	}
+}
+
+// TestProcessStdoutWhole tests if the whole stdout is delivered at once. The test succeeds if the output including its newlines arrives as a single message and output exceeding the maximum is truncated and reported, while a header line is rejected.
+func TestProcessStdoutWhole(t *testing.T) {
+	if _, err := New([]string{"true"}, WithStdoutWhole(0), WithHeaderLine()); err == nil {
+		t.Fatal("Creating a process with the whole stdout and a header line did not fail.")
+	}
+	p, err := StartProcess([]string{"printf", "foo\\nbar\\n"}, nil, nil, WithStdoutWhole(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := p.StdoutStream().Collect()
+	if len(lines) != 1 || string(lines[0]) != "foo\nbar\n" {
+		t.Fatalf("Process send %q to stdout, expected %q.", lines, []string{"foo\nbar\n"})
+	}
+	p, err = StartProcess([]string{"seq", "100000"}, nil, nil, WithStdoutWhole(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines = p.StdoutStream().Collect()
+	if len(lines) != 1 || string(lines[0]) != "1\n2\n" {
+		t.Fatalf("Process send %q to stdout, expected %q.", lines, []string{"1\n2\n"})
+	}
+	if err := <-p.Errors(); !errors.Is(err, ErrOutputTooLarge) {
+		t.Fatalf("Process reported %v, expected %v.", err, ErrOutputTooLarge)
+	}
+}
+
+// TestProcessColor tests the environment set by WithForceColor and WithNoColor. The test succeeds if the variables are set, the last option wins and variables of WithEnv take precedence.
+func TestProcessColor(t *testing.T) {
+	tests := []struct {
+		opts     []Option
+		expected string
+	}{
+		{[]Option{WithForceColor()}, "-1-1"},
+		{[]Option{WithForceColor(), WithNoColor()}, "1-0-0"},
+		{[]Option{WithNoColor(), WithEnv(map[string]string{"NO_COLOR": ""})}, "-0-0"},
+	}
+	for _, test := range tests {
+		p, err := StartProcess([]string{"sh", "-c", `echo "$NO_COLOR-$CLICOLOR_FORCE-$FORCE_COLOR"`}, nil, nil, test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := p.StdoutStream().Collect()
+		if len(lines) != 1 || string(lines[0]) != test.expected {
+			t.Fatalf("Process send %q to stdout, expected %q.", lines, test.expected)
+		}
+	}
+}
+
+// TestProcessStalls tests if blocked deliveries are recorded. The test succeeds if a consumer starting late causes stalls on stdout but not on stderr.
+func TestProcessStalls(t *testing.T) {
+	p, err := StartProcess([]string{"seq", "5000"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	Drain(p.Stdout())
+	p.Wait()
+	stdout, stderr := p.Stalls()
+	if stdout.Count == 0 || stdout.Duration <= 0 {
+		t.Fatalf("Process recorded stdout stalls %+v, expected stalls.", stdout)
+	}
+	if stderr != (Stalls{}) {
+		t.Fatalf("Process recorded stderr stalls %+v, expected none.", stderr)
+	}
+}
+
+// TestProcessReadBufferSize tests if lines are split correctly when read through a read buffer. The test succeeds if lines longer than the read buffer are delivered completely.
+func TestProcessReadBufferSize(t *testing.T) {
+	p, err := StartProcess([]string{"printf", "a\\n%s\\nb\\n", strings.Repeat("x", 100)}, nil, nil, WithReadBufferSize(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := p.StdoutStream().Collect()
+	expected := []string{"a", strings.Repeat("x", 100), "b"}
+	if len(lines) != 3 || string(lines[0]) != expected[0] || string(lines[1]) != expected[1] || string(lines[2]) != expected[2] {
+		t.Fatalf("Process send %q to stdout, expected %q.", lines, expected)
+	}
+}
+
+// TestProcessEmptyArgs tests the validation of empty arguments. The test succeeds if an empty program is rejected and an empty argument is passed to the process.
+func TestProcessEmptyArgs(t *testing.T) {
+	if _, err := New([]string{""}); err == nil {
+		t.Fatal("Creating a process with an empty program did not fail.")
+	}
+	if _, err := New([]string{"echo", ""}); err != nil {
+		t.Fatal(err)
+	}
+	p, err := StartProcess([]string{"sh", "-c", `echo "$#:$1"`, "sh", ""}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := p.StdoutStream().Collect()
+	if len(lines) != 1 || string(lines[0]) != "1:" {
+		t.Fatalf("Process send %q to stdout, expected %q.", lines, "1:")
+	}
+}
+
+// TestSupervisorStdinReplay tests if the last messages are replayed to a restarted process. The test succeeds if the restarted process receives the last 2 messages again.
+func TestSupervisorStdinReplay(t *testing.T) {
+	s := NewSupervisor(func() (*Process, error) {
+		return New([]string{"cat"})
+	}, WithRestartBackoff(time.Millisecond, time.Millisecond), WithStdinReplay(2, true))
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"x", "a", "b"} {
+		err = s.WriteLine([]byte(msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var lines []string
+	for len(lines) < 3 {
+		lines = append(lines, string(<-s.Stdout()))
+	}
+	s.Process().Kill()
+	for len(lines) < 5 {
+		lines = append(lines, string(<-s.Stdout()))
+	}
+	s.Stop()
+	expected := []string{"x", "a", "b", "a", "b"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("Supervisor send %q to stdout, expected %q.", lines, expected)
+	}
+}
+
+// TestProcessStdinStallWarn tests if a stalled write to stdin is reported. The test succeeds if a write to a process which does not read its stdin is reported once as stalled.
+func TestProcessStdinStallWarn(t *testing.T) {
+	stdin := make(chan []byte)
+	p, err := StartProcess([]string{"sleep", "10"}, stdin, nil, WithStdinStallWarn(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Kill()
+	stdin <- bytes.Repeat([]byte("x"), 1<<20)
+	select {
+	case err := <-p.Errors():
+		if !errors.Is(err, ErrStdinStalled) {
+			t.Fatalf("Process reported %v, expected %v.", err, ErrStdinStalled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Process did not report the stalled write within 1 second.")
+	}
+	select {
+	case err := <-p.Errors():
+		t.Fatalf("Process reported %v, expected no further error.", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestProcessReapingStress tests if many short-lived processes are reaped independently. The test succeeds if no zombie children remain after the processes have exited.
+func TestProcessReapingStress(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("/proc is not available")
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				p, err := StartProcess([]string{"true"}, nil, nil)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				DrainAll(p)
+				p.Wait()
+			}
+		}()
+	}
+	wg.Wait()
+	var zombies []string
+	deadline := time.Now().Add(time.Second)
+	for {
+		zombies = zombieChildren(t)
+		if len(zombies) == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(zombies) != 0 {
+		t.Fatalf("Zombie children %q remained, expected none.", zombies)
+	}
+}
+
+// zombieChildren returns the pids of the zombie children of the test process, read from /proc.
+func zombieChildren(t *testing.T) []string {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var zombies []string
+	for _, entry := range entries {
+		stat, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		end := bytes.LastIndexByte(stat, ')')
+		if end < 0 {
+			continue
+		}
+		fields := bytes.Fields(stat[end+1:])
+		if len(fields) >= 2 && string(fields[0]) == "Z" && string(fields[1]) == strconv.Itoa(os.Getpid()) {
+			zombies = append(zombies, entry.Name())
+		}
+	}
+	return zombies
+}
+
+// TestProcessHandoff tests if the output is handed off between consumers. The test succeeds if every line is received exactly once across the consumers and the channels of the previous consumer are closed.
+func TestProcessHandoff(t *testing.T) {
+	p, err := StartProcess([]string{"seq", "3000"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received []string
+	c := p.Handoff()
+	go Drain(c.Stderr())
+	for len(received) < 1000 {
+		line, ok := <-c.Stdout()
+		if !ok {
+			t.Fatal("The channel of the consumer has been closed early.")
+		}
+		received = append(received, string(line))
+	}
+	next := p.Handoff()
+	if _, ok := <-c.Stdout(); ok {
+		t.Fatal("The channel of the previous consumer received a line after the hand-off.")
+	}
+	go Drain(next.Stderr())
+	for line := range next.Stdout() {
+		received = append(received, string(line))
+	}
+	if len(received) != 3000 {
+		t.Fatalf("Consumers received %d lines, expected %d lines.", len(received), 3000)
+	}
+	for i, line := range received {
+		if line != strconv.Itoa(i+1) {
+			t.Fatalf("Line %d is %q, expected %q.", i, line, strconv.Itoa(i+1))
+		}
+	}
+}
+
+// TestProcessHandoffWithoutCopy tests if the lines handed to a consumer stay intact without copied output. The test succeeds if the consumer receives all lines unchanged although the scanner reuses its buffers.
+func TestProcessHandoffWithoutCopy(t *testing.T) {
+	p, err := StartProcess([]string{"seq", "1000"}, nil, nil, WithCopyOutput(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := p.Handoff()
+	go Drain(c.Stderr())
+	i := 0
+	for line := range c.Stdout() {
+		i++
+		if string(line) != strconv.Itoa(i) {
+			t.Fatalf("Line %d is %q, expected %q.", i, line, strconv.Itoa(i))
+		}
+	}
+	if i != 1000 {
+		t.Fatalf("Consumer received %d lines, expected %d lines.", i, 1000)
+	}
+}
+
+// TestProcessParentDeathSignal tests if the parent death signal is requested on Linux. The test succeeds if the signal is set for the process on Linux and the start fails with ErrNotSupported elsewhere.
+func TestProcessParentDeathSignal(t *testing.T) {
+	p, err := New([]string{"true"}, WithParentDeathSignal(syscall.SIGKILL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if runtime.GOOS != "linux" {
+		if !errors.Is(err, ErrNotSupported) {
+			t.Fatalf("Start returned %v, expected %v.", err, ErrNotSupported)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	DrainAll(p)
+	signal := reflect.ValueOf(p.Cmd().SysProcAttr).Elem().FieldByName("Pdeathsig").Interface()
+	if signal != syscall.SIGKILL {
+		t.Fatalf("Process has the parent death signal %v, expected %v.", signal, syscall.SIGKILL)
+	}
+}
+
+// TestProcessFirstOutput tests if the first line is reported once. The test succeeds if the callback is called exactly once with the first line and its stream.
+func TestProcessFirstOutput(t *testing.T) {
+	var calls atomic.Int32
+	var stream Stream
+	var first []byte
+	start := time.Now()
+	var at time.Time
+	p, err := StartProcess([]string{"sh", "-c", "echo error >&2; sleep 0.1; echo a; echo b >&2"}, nil, nil, WithFirstOutput(func(t time.Time, s Stream, line []byte) {
+		calls.Add(1)
+		at, stream, first = t, s, line
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	DrainAll(p)
+	p.Wait()
+	if calls.Load() != 1 || stream != StreamStderr || string(first) != "error" || at.Before(start) {
+		t.Fatalf("Callback has been called %d times with %v %q at %v, expected once with %v %q.", calls.Load(), stream, first, at, StreamStderr, "error")
+	}
+}
+
+// TestProcessWriteJSON tests if values are written to stdin as JSON lines. The test succeeds if the process receives the marshaled value as a line and a value which cannot be marshaled is rejected without writing.
+func TestProcessWriteJSON(t *testing.T) {
+	p, err := StartProcess([]string{"cat"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.WriteJSON(func() {}); err == nil {
+		t.Fatal("Writing a function as JSON did not fail.")
+	}
+	err = p.WriteJSON(map[string]any{"a": 1, "b": "x\ny"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(p.Stdin())
+	lines := p.StdoutStream().Collect()
+	if len(lines) != 1 || string(lines[0]) != `{"a":1,"b":"x\ny"}` {
+		t.Fatalf("Process send %q to stdout, expected %q.", lines, `{"a":1,"b":"x\ny"}`)
+	}
+}
+
+// TestProcessStdinBuffer tests if the owned stdin-channel is buffered. The test succeeds if messages can be enqueued before the start without blocking and all of them are written before stdin is closed, while a negative capacity is rejected.
+func TestProcessStdinBuffer(t *testing.T) {
+	if _, err := New([]string{"cat"}, WithStdinBuffer(-1)); err == nil {
+		t.Fatal("Creating a process with a negative stdin buffer capacity did not fail.")
+	}
+	p, err := New([]string{"cat"}, WithStdinBuffer(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"a", "b", "c"} {
+		p.Stdin() <- []byte(msg)
+	}
+	close(p.Stdin())
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := p.StdoutStream().Collect()
+	if len(lines) != 3 || string(lines[0]) != "a" || string(lines[2]) != "c" {
+		t.Fatalf("Process send %q to stdout, expected %q.", lines, []string{"a", "b", "c"})
+	}
+}
+
+// TestProcessTimestamps tests if the lines carry the time they have been read. The test succeeds if the timestamps reflect when the lines have been written, not when they have been received.
+func TestProcessTimestamps(t *testing.T) {
+	p, err := StartProcess([]string{"sh", "-c", "echo a; sleep 0.2; echo b"}, nil, nil, WithLines(), WithTimestamps())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Wait()
+	time.Sleep(200 * time.Millisecond)
+	received := time.Now()
+	var lines []Line
+	for line := range p.Lines() {
+		lines = append(lines, line)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("Process send %d lines, expected %d lines.", len(lines), 2)
+	}
+	if delay, gap := received.Sub(lines[1].At), lines[1].At.Sub(lines[0].At); delay < 200*time.Millisecond || gap < 150*time.Millisecond || gap > 350*time.Millisecond {
+		t.Fatalf("Lines have been read %v apart and %v before they have been received, expected about 200ms apart and at least 200ms before.", gap, delay)
+	}
+}
+
+// TestProcessDetachOutput tests if the output is discarded after detaching it. The test succeeds if a process writing more than the buffers can hold exits after the consumer detached the output.
+func TestProcessDetachOutput(t *testing.T) {
+	p, err := StartProcess([]string{"sh", "-c", "echo ready; seq 100000; seq 100000 >&2"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := <-p.Stdout(); string(line) != "ready" {
+		t.Fatalf("Process send %q to stdout, expected %q.", line, "ready")
+	}
+	p.DetachOutput()
+	select {
+	case <-p.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Process did not exit within 5 seconds after detaching the output.")
+	}
+	Drain(p.Stdout())
+	Drain(p.Stderr())
+}
+
+// TestRunExpectZero tests running a process to completion. The test succeeds if the stdout of a successful process is returned and a failing process results in an *ExitError with its exit code and stderr.
+func TestRunExpectZero(t *testing.T) {
+	stdout, err := RunExpectZero(context.Background(), "printf", "a\\nb")
+	if err != nil || string(stdout) != "a\nb" {
+		t.Fatalf("RunExpectZero returned %q and %v, expected %q.", stdout, err, "a\nb")
+	}
+	_, err = RunExpectZero(context.Background(), "sh", "-c", "echo out; echo failed >&2; exit 3")
+	var exitErr *ExitError
+	if !errors.Is(err, ErrNonZeroExit) || !errors.As(err, &exitErr) || exitErr.Code != 3 || string(exitErr.Stderr) != "failed\n" {
+		t.Fatalf("RunExpectZero returned %v, expected an exit error with code 3 and stderr %q.", err, "failed\n")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = RunExpectZero(ctx, "sleep", "10")
+	if err != context.DeadlineExceeded {
+		t.Fatalf("RunExpectZero returned %v, expected %v.", err, context.DeadlineExceeded)
+	}
+}
+
+// TestProcessEndRequest tests if the end of a request is marked without closing stdin. The test succeeds if the process receives the delimiter between the requests and keeps reading its stdin, and EndRequest fails without a delimiter.
+func TestProcessEndRequest(t *testing.T) {
+	p, err := StartProcess([]string{"cat"}, nil, nil, WithRequestDelimiter([]byte("---")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, write := range []func() error{
+		func() error { return p.WriteLine([]byte("a")) },
+		p.EndRequest,
+		func() error { return p.WriteLine([]byte("b")) },
+	} {
+		err = write()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(p.Stdin())
+	lines := p.StdoutStream().Collect()
+	if len(lines) != 3 || string(lines[0]) != "a" || string(lines[1]) != "---" || string(lines[2]) != "b" {
+		t.Fatalf("Process send %q to stdout, expected %q.", lines, []string{"a", "---", "b"})
+	}
+	p, err = StartProcess([]string{"cat"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Kill()
+	if err := p.EndRequest(); err != ErrNoRequestDelimiter {
+		t.Fatalf("EndRequest returned %v, expected %v.", err, ErrNoRequestDelimiter)
+	}
+}
+
+// TestExitStatusString tests the description of exit statuses. The test succeeds if an exit code and a terminating signal are described with the name of the signal.
+func TestExitStatusString(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"sh", "-c", "exit 3"}, "exited with code 3"},
+		{[]string{"sh", "-c", "kill -TERM $$"}, "killed by signal: terminated (SIGTERM)"},
+	}
+	for _, test := range tests {
+		p, err := StartProcess(test.args, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		DrainAll(p)
+		if status := <-p.Exit(); status.String() != test.expected {
+			t.Fatalf("Exit status is described as %q, expected %q.", status.String(), test.expected)
+		}
+	}
+	status := ExitStatus{Code: -1, Signal: syscall.SIGSEGV, CoreDumped: true}
+	if expected := "killed by signal: segmentation fault (SIGSEGV), core dumped"; status.String() != expected {
+		t.Fatalf("Exit status is described as %q, expected %q.", status.String(), expected)
+	}
+}
+
+// TestProcessSocketActivation tests if extra files are passed like systemd socket activation. The test succeeds if the process can read the extra file from fd 3 and LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES are set accordingly.
+func TestProcessSocketActivation(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	writer.Write([]byte("activated\n"))
+	writer.Close()
+	if _, err := New([]string{"true"}, WithSocketActivation()); err == nil {
+		t.Fatal("Creating a process with socket activation but without extra files did not fail.")
+	}
+	p, err := StartProcess([]string{"sh", "-c", `test "$LISTEN_PID" = $$ && echo "$LISTEN_FDS $LISTEN_FDNAMES" && cat <&3`}, nil, nil, WithExtraFiles(reader), WithSocketActivation("http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := p.StdoutStream().Collect()
+	if len(lines) != 2 || string(lines[0]) != "1 http" || string(lines[1]) != "activated" {
+		t.Fatalf("Process send %q to stdout, expected %q.", lines, []string{"1 http", "activated"})
+	}
+}
+
+// TestProcessUmask tests if the umask is set in the process. The test succeeds if the process reports the given umask, also in combination with socket activation, keeps its arguments, a missing executable fails to start with ErrNotFound and an invalid umask or a umask combined with a path are rejected.
+func TestProcessUmask(t *testing.T) {
+	if _, err := New([]string{"true"}, WithUmask(0o1000)); err == nil {
+		t.Fatal("Creating a process with an invalid umask did not fail.")
+	}
+	if _, err := New([]string{"true"}, WithUmask(0o022), WithPath("/bin/true")); err == nil {
+		t.Fatal("Creating a process with a umask and a path did not fail.")
+	}
+	if _, err := StartProcess([]string{"goprocess-does-not-exist"}, nil, nil, WithUmask(0o022)); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Starting a missing executable with a umask returned %v, expected %v.", err, ErrNotFound)
+	}
+	p, err := StartProcess([]string{"sh", "-c", "umask"}, nil, nil, WithUmask(0o027))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := string(<-p.Stdout()); msg != "0027" {
+		t.Fatalf("Process send %q to stdout, expected %q.", msg, "0027")
+	}
+	if runtime.GOOS == "linux" {
+		p, err = StartProcess([]string{"cat", "/proc/self/cmdline"}, nil, nil, WithUmask(0o022))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg := string(<-p.Stdout()); msg != "cat\x00/proc/self/cmdline\x00" {
+			t.Fatalf("Process has the arguments %q, expected %q.", msg, "cat\x00/proc/self/cmdline\x00")
+		}
+	}
+	p, err = StartProcess([]string{"sh", "-c", `umask && test "$LISTEN_PID" = $$ && echo ok`}, nil, nil, WithUmask(0o077), WithExtraFiles(os.Stdin), WithSocketActivation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := p.StdoutStream().Collect()
+	if len(lines) != 2 || string(lines[0]) != "0077" || string(lines[1]) != "ok" {
+		t.Fatalf("Process send %q to stdout, expected %q.", lines, []string{"0077", "ok"})
+	}
+}
+
+// TestProcessFixedChunkSize tests if stdout is delivered in chunks of a fixed size. The test succeeds if the output including the newlines is split into chunks of 4 bytes and the last, shorter chunk is delivered as well.
+func TestProcessFixedChunkSize(t *testing.T) {
+	p, err := StartProcess([]string{"printf", "ab\ncdefghij"}, nil, nil, WithFixedChunkSize(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chunks []string
+	for chunk := range p.Stdout() {
+		chunks = append(chunks, string(chunk))
+	}
+	expected := []string{"ab\nc", "defg", "hij"}
+	if !reflect.DeepEqual(chunks, expected) {
+		t.Fatalf("Process send %q to stdout, expected %q.", chunks, expected)
+	}
+}
+
+// TestProcessStdoutTee tests if stdout is written to a tee set while the process is running. The test succeeds if only the lines read between setting and clearing the tee are written to it after being redacted, while all lines are delivered, and the header line is written to it as well.
+func TestProcessStdoutTee(t *testing.T) {
+	redactor := func(data []byte) []byte {
+		return bytes.ReplaceAll(data, []byte("c"), []byte("*"))
+	}
+	p, err := StartProcess([]string{"cat"}, nil, nil, WithRedactor(redactor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tee bytes.Buffer
+	for _, line := range []string{"a", "b", "c", "d"} {
+		if line == "b" {
+			p.SetStdoutTee(&tee)
+		}
+		if line == "d" {
+			p.ClearStdoutTee()
+		}
+		p.Stdin() <- []byte(line)
+		if msg := string(<-p.Stdout()); msg != line {
+			t.Fatalf("Process send %q to stdout, expected %q.", msg, line)
+		}
+	}
+	close(p.Stdin())
+	if tee.String() != "b\n*\n" {
+		t.Fatalf("The tee received %q, expected %q.", tee.String(), "b\n*\n")
+	}
+	p, err = New([]string{"printf", "header\\nbody\\n"}, WithHeaderLine())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tee.Reset()
+	p.SetStdoutTee(&tee)
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-p.Header()
+	Drain(p.Stdout())
+	if tee.String() != "header\nbody\n" {
+		t.Fatalf("The tee received %q, expected %q.", tee.String(), "header\nbody\n")
+	}
+}
+
+// TestProcessStdoutPending tests if the number of buffered lines is reported. The test succeeds if the lines written by the process are pending until they are received.
+func TestProcessStdoutPending(t *testing.T) {
+	p, err := StartProcess([]string{"seq", "3"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for p.StdoutPending() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if p.StdoutPending() != 3 || p.StderrPending() != 0 {
+		t.Fatalf("Process has %d lines of stdout and %d lines of stderr pending, expected 3 and 0.", p.StdoutPending(), p.StderrPending())
+	}
+	<-p.Stdout()
+	if p.StdoutPending() != 2 {
+		t.Fatalf("Process has %d lines of stdout pending, expected 2.", p.StdoutPending())
+	}
+}
+
+// TestProcessOutputThrough tests if stdout is piped through a filter. The test succeeds if the stdout-channel receives the output of the filter and terminating the process stops the filter as well.
+func TestProcessOutputThrough(t *testing.T) {
+	p, err := StartProcess([]string{"seq", "10"}, nil, nil, WithOutputThrough([]string{"grep", "5"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := p.StdoutStream().Collect()
+	if len(lines) != 1 || string(lines[0]) != "5" {
+		t.Fatalf("Process send %q to stdout, expected %q.", lines, []string{"5"})
+	}
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	p, err = StartProcess([]string{"sh", "-c", "echo a; exec sleep 10"}, nil, nil, WithOutputThrough([]string{"cat"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go Drain(p.Stderr())
+	if line := <-p.Stdout(); string(line) != "a" {
+		t.Fatalf("Process send %q to stdout, expected %q.", line, "a")
+	}
+	p.Terminate(time.Second)
+	select {
+	case _, ok := <-p.Stdout():
+		if ok {
+			t.Fatal("Process send another line to stdout, expected the end of the output.")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The filter did not close stdout within 1 second after terminating the process.")
+	}
+}
+
+// TestProcessCurrentDir tests if the current working directory of the running process is reported. The test succeeds if the directory changed by the process is returned on Linux and ErrNotSupported elsewhere.
+func TestProcessCurrentDir(t *testing.T) {
+	dir := t.TempDir()
+	p, err := StartProcess([]string{"sh", "-c", "cd \"$0\" && echo ready && exec sleep 10", dir}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Kill()
+	go Drain(p.Stderr())
+	<-p.Stdout()
+	current, err := p.CurrentDir()
+	if runtime.GOOS != "linux" {
+		if !errors.Is(err, ErrNotSupported) {
+			t.Fatalf("CurrentDir returned %v, expected %v.", err, ErrNotSupported)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != dir {
+		t.Fatalf("CurrentDir returned %q, expected %q.", current, dir)
+	}
+}
+
+// TestProcessStats tests the statistics of splitting the output into lines. The test succeeds if the longest line, the bytes read and the growths of the buffer for a long line are reported.
+func TestProcessStats(t *testing.T) {
+	p, err := StartProcess([]string{"sh", "-c", "echo a; head -c 20000 /dev/zero | tr '\\0' x; echo; echo b >&2"}, nil, nil, WithScannerBuffer(1024, 65536))
+	if err != nil {
+		t.Fatal(err)
+	}
+	DrainAll(p)
+	stdout, stderr := p.Stats()
+	if stdout.LongestLine != 20000 || stdout.Bytes != 20003 || stdout.BufferGrowths == 0 {
+		t.Fatalf("Process reported the stdout statistics %+v, expected the longest line of 20000 bytes, 20003 bytes and buffer growths.", stdout)
+	}
+	if stderr != (ScanStats{LongestLine: 1, Bytes: 2}) {
+		t.Fatalf("Process reported the stderr statistics %+v, expected %+v.", stderr, ScanStats{LongestLine: 1, Bytes: 2})
+	}
+}
+
+// TestProcessStdinSeparator tests if stdin messages are separated instead of terminated. The test succeeds if the separator is written between the messages but not after the last one.
+func TestProcessStdinSeparator(t *testing.T) {
+	stdin := make(chan []byte)
+	p, err := StartProcess([]string{"cat"}, stdin, nil, WithStdinSeparator([]byte(",")), WithStdoutWhole(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"a", "b", "c"} {
+		stdin <- []byte(msg)
+	}
+	close(stdin)
+	lines := p.StdoutStream().Collect()
+	if len(lines) != 1 || string(lines[0]) != "a,b,c" {
+		t.Fatalf("Process send %q to stdout, expected %q.", lines, "a,b,c")
+	}
+}
+
+// TestProcessOutputThroughCombined tests if combined output is piped through the filter and the filter is reaped without reaping the process. The test succeeds if both streams of the process pass the filter and the filter has been reaped once the process is done.
+func TestProcessOutputThroughCombined(t *testing.T) {
+	p, err := StartProcess([]string{"sh", "-c", "echo out; echo err >&2"}, nil, nil, WithCombinedOutput(), WithOutputThrough([]string{"sed", "s/^/F:/"}), WithReaping(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := p.StdoutStream().Collect()
+	if len(lines) != 2 || string(lines[0]) != "F:out" || string(lines[1]) != "F:err" {
+		t.Fatalf("Process send %q to stdout, expected %q.", lines, []string{"F:out", "F:err"})
+	}
+	<-p.Done()
+	if p.filter.ProcessState == nil {
+		t.Fatal("The filter has not been reaped.")
+	}
+	p.Cmd().Process.Wait()
+}
+
+// TestProcessStdinClosedByProcess tests if a process closing its stdin is detected. The test succeeds if the closed stdin is reported once, although several messages are dropped, while the process keeps running.
+func TestProcessStdinClosedByProcess(t *testing.T) {
+	stdin := make(chan []byte)
+	p, err := StartProcess([]string{"sh", "-c", "exec 0<&-; echo closed; exec sleep 10"}, stdin, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Kill()
+	go Drain(p.Stderr())
+	<-p.Stdout()
+	for i := 0; i < 3; i++ {
+		stdin <- []byte("message")
+	}
+	select {
+	case <-p.StdinClosedByProcess():
+	case <-time.After(time.Second):
+		t.Fatal("The closed stdin has not been detected within 1 second.")
+	}
+	if err := p.WriteLine([]byte("message")); !errors.Is(err, syscall.EPIPE) {
+		t.Fatalf("WriteLine returned %v, expected %v.", err, syscall.EPIPE)
+	}
+	if err := <-p.Errors(); !errors.Is(err, ErrStdinClosedByProcess) {
+		t.Fatalf("Process reported %v, expected %v.", err, ErrStdinClosedByProcess)
+	}
+	select {
+	case err := <-p.Errors():
+		t.Fatalf("Process reported %v, expected no further error.", err)
+	default:
+	}
+	if p.StdinOpen() {
+		t.Fatal("The stdin of the process is reported as open.")
+	}
+}
+
+// TestProcessStdinTruncated tests if messages of the stdin-channel which could not be written because the process exited are reported. The test succeeds if no StdinTruncatedError is reported for a process which closed its stdin but is still running, and a StdinTruncatedError with the number of unsent messages is reported for a process which exited before or while the messages are written.
+func TestProcessStdinTruncated(t *testing.T) {
+	stdin := make(chan []byte)
+	p, err := StartProcess([]string{"sh", "-c", "exec 0<&-; echo closed; exec sleep 10"}, stdin, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-p.Stdout()
+	for i := 0; i < 2; i++ {
+		stdin <- []byte("message")
+	}
+	close(stdin)
+	<-p.StdinDone()
+	p.Kill()
+	timeout := time.After(100 * time.Millisecond)
+	for waiting := true; waiting; {
+		select {
+		case err := <-p.Errors():
+			if errors.Is(err, ErrStdinTruncated) {
+				t.Fatalf("Process reported %v for messages rejected while running.", err)
+			}
+		case <-timeout:
+			waiting = false
+		}
+	}
+	stdin = make(chan []byte)
+	p, err = StartProcess([]string{"true"}, stdin, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-p.Done()
+	for i := 0; i < 3; i++ {
+		stdin <- []byte("message")
+	}
+	close(stdin)
+	if truncated := truncatedStdin(t, p); truncated.Unsent != 3 {
+		t.Fatalf("Process reported %v, expected 3 unsent messages.", truncated)
+	}
+	stdin = make(chan []byte)
+	p, err = StartProcess([]string{"head", "-n", "1"}, stdin, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go DrainAll(p)
+	message := []byte(strings.Repeat("m", 1024))
+	for i := 0; i < 500; i++ {
+		stdin <- message
+	}
+	close(stdin)
+	if truncated := truncatedStdin(t, p); truncated.Unsent <= 0 || truncated.Unsent >= 500 {
+		t.Fatalf("Process reported %v, expected some of 500 messages unsent.", truncated)
+	}
+}
+
+// truncatedStdin returns the StdinTruncatedError reported by the process within 1 second, skipping other errors.
+func truncatedStdin(t *testing.T, p *Process) *StdinTruncatedError {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case err := <-p.Errors():
+			var truncated *StdinTruncatedError
+			if errors.As(err, &truncated) && errors.Is(err, ErrStdinTruncated) {
+				return truncated
+			}
+		case <-timeout:
+			t.Fatal("The truncated stdin has not been reported within 1 second.")
+		}
+	}
+}
+
+// TestProcessFromCmd tests if a process can be created from a command built by the caller. The test succeeds if the configuration of the command is used, the output is delivered and commands with streams already set or conflicting options are rejected.
+func TestProcessFromCmd(t *testing.T) {
+	dir := t.TempDir()
+	command := exec.CommandContext(context.Background(), "sh", "-c", `pwd; echo "$GOPROCESS_TEST"`)
+	command.Dir = dir
+	command.Env = []string{"GOPROCESS_TEST=cmd"}
+	p, err := NewFromCmd(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := p.StdoutStream().Collect()
+	if len(lines) != 2 || string(lines[0]) != dir || string(lines[1]) != "cmd" {
+		t.Fatalf("Process send %q to stdout, expected %q.", lines, []string{dir, "cmd"})
+	}
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	command = exec.Command("true")
+	command.Stdout = os.Stdout
+	if _, err := NewFromCmd(command); err == nil {
+		t.Fatal("Creating a process from a command with stdout set did not fail.")
+	}
+	if _, err := NewFromCmd(exec.Command("true"), WithDir(dir)); err == nil {
+		t.Fatal("Creating a process from a command with WithDir did not fail.")
+	}
+}
+
+// TestProcessAllowedExecutables tests if only executables of the allowlist may be launched. The test succeeds if an allowed executable is launched by its resolved path and other executables, a shell and a prebuilt command of another executable are rejected.
+func TestProcessAllowedExecutables(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := StartProcess([]string{"sh", "-c", "echo ok"}, nil, nil, WithAllowedExecutables(sh))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := string(<-p.Stdout()); msg != "ok" {
+		t.Fatalf("Process send %q to stdout, expected %q.", msg, "ok")
+	}
+	if _, err := New([]string{"true"}, WithAllowedExecutables(sh)); !errors.Is(err, ErrExecutableNotAllowed) {
+		t.Fatalf("Creating a process of an executable not allowed returned %v, expected %v.", err, ErrExecutableNotAllowed)
+	}
+	if _, err := New([]string{"echo ok"}, WithAllowedExecutables(sh), WithShell("sh", false)); err == nil {
+		t.Fatal("Creating a process with allowed executables and a shell did not fail.")
+	}
+	if _, err := NewFromCmd(exec.Command("true"), WithAllowedExecutables(sh)); !errors.Is(err, ErrExecutableNotAllowed) {
+		t.Fatalf("Creating a process of a command not allowed returned %v, expected %v.", err, ErrExecutableNotAllowed)
+	}
+}
@@ -0,0 +1,52 @@
+package goprocess
+
+import (
+	"sync"
+)
+
+// ring retains the last lines added to it. It is safe for concurrent use.
+type ring struct {
+	mutex sync.Mutex
+	lines [][]byte
+	// next is the index of the slot of the next line
+	next int
+	full bool
+}
+
+func newRing(size int) *ring {
+	return &ring{lines: make([][]byte, size)}
+}
+
+// add copies the line into the ring, replacing the oldest line if the ring is full. The memory of a replaced line is reused.
+func (r *ring) add(line []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.lines[r.next] = append(r.lines[r.next][:0], line...)
+	r.next++
+	if r.next == len(r.lines) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// last returns copies of the last n lines, oldest first.
+func (r *ring) last(n int) [][]byte {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	count := r.next
+	if r.full {
+		count = len(r.lines)
+	}
+	n = max(min(n, count), 0)
+	lines := make([][]byte, n)
+	for i := range lines {
+		index := (r.next - n + i + len(r.lines)) % len(r.lines)
+		lines[i] = append([]byte(nil), r.lines[index]...)
+	}
+	return lines
+}
+
+// size returns the maximum number of lines retained.
+func (r *ring) size() int {
+	return len(r.lines)
+}
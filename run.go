@@ -0,0 +1,44 @@
+package goprocess
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// RunExpectZero runs the process to completion and returns its stdout, e.g. for tools whose output is the result. Stdin is connected to the null device. If the process does not exit with code 0, the error is an *ExitError carrying the exit code and stderr, which matches ErrNonZeroExit by errors.Is. If the context is done before the process exited, the process is terminated gracefully (see DefaultGracePeriod) and the error of the context is returned.
+func RunExpectZero(ctx context.Context, args ...string) ([]byte, error) {
+	stdin, err := os.Open(os.DevNull)
+	if err != nil {
+		return nil, err
+	}
+	defer stdin.Close()
+	p, err := New(args, WithContext(ctx), WithStdinSource(stdin), WithStdoutWhole(0), WithKeepDelimiter(true))
+	if err != nil {
+		return nil, err
+	}
+	err = p.Start()
+	if err != nil {
+		return nil, err
+	}
+	stderr := make(chan []byte, 1)
+	go func() {
+		stderr <- bytes.Join(p.StderrStream().Collect(), nil)
+	}()
+	stdout := <-p.Stdout()
+	Drain(p.Stdout())
+	err = p.Wait()
+	if err == nil {
+		return stdout, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil, &ExitError{Code: exitErr.ExitCode(), Stderr: <-stderr}
+	}
+	return nil, err
+}
@@ -0,0 +1,12 @@
+//go:build unix && !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package goprocess
+
+import (
+	"os"
+)
+
+// maxRSS returns 0, since the maximum resident set size is not reported on these platforms.
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
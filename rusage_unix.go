@@ -0,0 +1,17 @@
+//go:build linux || freebsd || netbsd || openbsd || dragonfly
+
+package goprocess
+
+import (
+	"os"
+	"syscall"
+)
+
+// maxRSS returns the maximum resident set size in bytes. These platforms report it in kilobytes.
+func maxRSS(state *os.ProcessState) int64 {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	return int64(rusage.Maxrss) * 1024
+}
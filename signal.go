@@ -0,0 +1,254 @@
+package goprocess
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// StopStep is a step of the sequence stopping the process, see WithStopSequence.
+type StopStep struct {
+	// WaitBefore is the time to wait for the exit of the process before sending the signal.
+	WaitBefore time.Duration
+	// Signal is the signal sent to the process group.
+	Signal syscall.Signal
+}
+
+// Terminate stops the process gracefully. It sends SIGTERM to the process group and, if the process did not exit within the grace period, SIGKILL. If a stop sequence is given by WithStopSequence, Terminate walks the sequence instead and ignores the grace period. Terminate returns once the process has exited. An exit caused by Terminate is reported by IntentionallyStopped.
+func (p *Process) Terminate(grace time.Duration) error {
+	steps := p.options.stopSequence
+	if steps == nil {
+		steps = []StopStep{{Signal: syscall.SIGTERM}, {WaitBefore: grace, Signal: syscall.SIGKILL}}
+	}
+	for _, step := range steps {
+		if step.WaitBefore > 0 {
+			timer := p.clock().NewTimer(step.WaitBefore)
+			select {
+			case <-p.done:
+				timer.Stop()
+				return nil
+			case <-timer.C():
+			}
+		}
+		err := p.stop(step.Signal)
+		if err != nil {
+			return err
+		}
+	}
+	<-p.done
+	return nil
+}
+
+// Kill stops the process immediately by sending SIGKILL to the process group and returns once the process has been reaped. It also closes the stdin-pipe, so that a pending write to the process is aborted; later messages on the stdin-channel are dropped. Output which has been buffered inside the process (e.g. by stdio) is lost. An exit caused by Kill is reported by IntentionallyStopped.
+func (p *Process) Kill() error {
+	err := p.stop(syscall.SIGKILL)
+	if err != nil {
+		return err
+	}
+	p.closeStdin()
+	<-p.done
+	return nil
+}
+
+// IntentionallyStopped returns whether the process has been stopped by Terminate or Kill. It allows supervisors to tell an intentional stop apart from an abnormal exit, since both may result in the same exit status (e.g. killed by SIGKILL).
+func (p *Process) IntentionallyStopped() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.stopped
+}
+
+// watchStop terminates the process gracefully as soon as the context is done or the stop-channel is closed, whichever happens first.
+func (p *Process) watchStop() {
+	if p.options.context == nil && p.options.stop == nil {
+		return
+	}
+	var contextDone <-chan struct{}
+	if p.options.context != nil {
+		contextDone = p.options.context.Done()
+	}
+	go func() {
+		select {
+		case <-contextDone:
+		case <-p.options.stop:
+		case <-p.done:
+			return
+		}
+		p.Terminate(p.options.gracePeriod)
+	}()
+}
+
+// watchStartupSilence terminates the process gracefully if it does not produce any output within the timeout set by WithStartupSilenceTimeout.
+func (p *Process) watchStartupSilence() {
+	timeout := p.options.startupSilenceTimeout
+	if timeout <= 0 {
+		return
+	}
+	go func() {
+		timer := p.clock().NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C():
+		case <-p.firstOutput:
+			return
+		case <-p.done:
+			return
+		}
+		p.startupFailed.Store(true)
+		p.reportError(fmt.Errorf("%w: no output within %v", ErrStartupSilence, timeout))
+		p.Terminate(p.options.gracePeriod)
+	}()
+}
+
+// StartupFailed returns whether the process has been terminated because it did not produce any output within the timeout set by WithStartupSilenceTimeout.
+func (p *Process) StartupFailed() bool {
+	return p.startupFailed.Load()
+}
+
+// stop sends the given signal to the process group and records the intentional stop. A process which already exited is neither signaled nor recorded as stopped.
+func (p *Process) stop(signal syscall.Signal) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.started {
+		return ErrNotStarted
+	}
+	select {
+	case <-p.done:
+		return nil
+	default:
+	}
+	p.stopped = true
+	if p.filter != nil && !p.groupLeader {
+		// the filter is only reached by signals to the process group
+		p.kill(p.filter.Process.Pid, signal)
+	}
+	err := p.kill(p.signalTarget(), signal)
+	if err == syscall.ESRCH {
+		// the process exited in the meantime
+		return nil
+	}
+	return err
+}
+
+// forwardSignals forwards the signals of the signals-channel to the process until the channel is closed.
+func (p *Process) forwardSignals() {
+	go func() {
+		for s := range p.signals {
+			select {
+			case <-p.done:
+				// the pid may have been reused by another process
+				continue
+			default:
+			}
+			if p.filter != nil && !p.groupLeader {
+				p.kill(p.filter.Process.Pid, s.(syscall.Signal))
+			}
+			p.kill(p.signalTarget(), s.(syscall.Signal))
+		}
+	}()
+}
+
+// kill sends the signal to the target, which is a pid or a negated process group id like for kill(2), by the killer given by WithKiller or by syscall.Kill.
+func (p *Process) kill(target int, signal syscall.Signal) error {
+	if p.options.killer != nil {
+		return p.options.killer(target, signal)
+	}
+	return syscall.Kill(target, signal)
+}
+
+// signalTarget returns the pid to signal: the process group if the process leads a process group of its own, the process only otherwise.
+func (p *Process) signalTarget() int {
+	if p.groupLeader {
+		// https://medium.com/@felixge/killing-a-child-process-and-all-of-its-children-in-go-54079af94773
+		return -p.command.Process.Pid
+	}
+	return p.command.Process.Pid
+}
+
+// SignalPid sends the signal to a single process of the process tree: the process itself or, if it leads a process group of its own (see WithProcessGroup), a member of that group. Any other pid is rejected with ErrNotInProcessGroup before anything is sent, so that a pid taken from untrusted input or a stale pid cannot signal an unrelated process. Unlike Signals, the signal does not reach the rest of the process group.
+//
+// The process group id stays reserved while the group has members, so the check is reliable for members of the group even after the process exited. The process itself is not signaled anymore once it exited, since its pid may have been reused.
+func (p *Process) SignalPid(pid int, signal syscall.Signal) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.started {
+		return ErrNotStarted
+	}
+	leader := p.command.Process.Pid
+	if pid == leader {
+		select {
+		case <-p.done:
+			return nil
+		default:
+		}
+		return p.kill(pid, signal)
+	}
+	if pid <= 0 || !p.groupLeader {
+		return fmt.Errorf("%w: pid %d", ErrNotInProcessGroup, pid)
+	}
+	pgid, err := syscall.Getpgid(pid)
+	if err != nil || pgid != leader {
+		return fmt.Errorf("%w: pid %d", ErrNotInProcessGroup, pid)
+	}
+	return p.kill(pid, signal)
+}
+
+// leadsProcessGroup returns whether the process with the given pid leads a process group of its own. Requesting a process group (Setpgid) may have no effect on some platforms, so signaling the negative pid must not be assumed to be safe: it could target another group or fail.
+func leadsProcessGroup(pid int) bool {
+	pgid, err := syscall.Getpgid(pid)
+	return err == nil && pgid == pid
+}
+
+// KillTree kills the process and all of its descendants with SIGKILL and returns once the process has been reaped. Unlike Kill, it does not rely on the process group, so it also reaches descendants when the process group is disabled (see WithProcessGroup) or descendants which moved to process groups of their own.
+//
+// The descendants are enumerated via their parent pids: on Linux from /proc, on the other Unix platforms by running ps (Windows and its job objects are not supported, see the package documentation). This is best effort: the descendants are stopped with SIGSTOP before being killed, which catches processes forked during the enumeration, but a descendant which has already been re-parented (because its parent exited) cannot be found anymore. An exit caused by KillTree is reported by IntentionallyStopped.
+func (p *Process) KillTree() error {
+	p.mutex.Lock()
+	if !p.started {
+		p.mutex.Unlock()
+		return ErrNotStarted
+	}
+	select {
+	case <-p.done:
+		p.mutex.Unlock()
+		return nil
+	default:
+	}
+	p.stopped = true
+	pid := p.command.Process.Pid
+	p.mutex.Unlock()
+	tree, err := processTree(pid)
+	if err != nil {
+		return err
+	}
+	for _, pid := range tree {
+		p.kill(pid, syscall.SIGSTOP)
+	}
+	// descendants forked before they have been stopped
+	stoppedTree, err := processTree(pid)
+	if err == nil {
+		tree = append(tree, stoppedTree...)
+	}
+	for _, pid := range tree {
+		p.kill(pid, syscall.SIGKILL)
+	}
+	p.closeStdin()
+	<-p.done
+	return nil
+}
+
+// processTree returns the pid and the pids of all descendants of the given process, parents before children.
+func processTree(pid int) ([]int, error) {
+	parents, err := parentPids()
+	if err != nil {
+		return nil, err
+	}
+	children := make(map[int][]int)
+	for child, parent := range parents {
+		children[parent] = append(children[parent], child)
+	}
+	tree := []int{pid}
+	for i := 0; i < len(tree); i++ {
+		tree = append(tree, children[tree[i]]...)
+	}
+	return tree, nil
+}
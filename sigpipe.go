@@ -0,0 +1,29 @@
+package goprocess
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// sigpipeMutex serializes the starts of processes which temporarily change the disposition of SIGPIPE.
+var sigpipeMutex sync.Mutex
+
+// startCommandWithDefaultSIGPIPE starts the command with the default disposition of SIGPIPE in the process.
+//
+// There is no hook running between fork and exec, so the disposition is set up in the parent: exec resets signals which are handled to the default disposition but keeps ignored signals ignored. Therefore SIGPIPE is handled by the Go runtime while the command is started, and the previous disposition is restored afterwards.
+func startCommandWithDefaultSIGPIPE(command *exec.Cmd) error {
+	sigpipeMutex.Lock()
+	defer sigpipeMutex.Unlock()
+	ignored := signal.Ignored(syscall.SIGPIPE)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGPIPE)
+	err := command.Start()
+	signal.Stop(signals)
+	if ignored {
+		signal.Ignore(syscall.SIGPIPE)
+	}
+	return err
+}
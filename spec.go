@@ -0,0 +1,60 @@
+package goprocess
+
+import (
+	"maps"
+)
+
+// ExecSpec describes how to launch a process: its arguments, working directory and the variables added to its environment. It is serializable (e.g. as JSON), so a process definition can be persisted and replayed later or on another host via NewProcessFromSpec.
+//
+// The environment often contains secrets. Use Redacted before logging or displaying a spec.
+type ExecSpec struct {
+	Args []string          `json:"args"`
+	Dir  string            `json:"dir,omitempty"`
+	Env  map[string]string `json:"env,omitempty"`
+}
+
+// ExecSpec returns the specification of the process. Env holds the variables given by WithEnv or WithEnvFunc, not the inherited environment which depends on the host, nor the variables of WithForceColor or WithNoColor. With WithEnvFunc, these are the variables the process has been started with, or the current result of the function if the process has not been started yet.
+//
+// For a process created by NewFromCmd, Dir is the directory of the command and Env is empty, since the environment of the command cannot be told apart from the inherited one. Only the arguments, the working directory and the environment are captured. Other options (e.g. WithPath or WithShell) have to be passed again to NewProcessFromSpec.
+func (p *Process) ExecSpec() ExecSpec {
+	p.mutex.Lock()
+	env := p.env
+	args := append([]string(nil), p.args...)
+	p.mutex.Unlock()
+	if env == nil && p.options.env != nil {
+		env = p.options.env()
+	}
+	dir := p.options.dir
+	if p.prebuilt != nil {
+		dir = p.prebuilt.Dir
+	}
+	return ExecSpec{
+		Args: args,
+		Dir:  dir,
+		Env:  maps.Clone(env),
+	}
+}
+
+// NewProcessFromSpec creates a new process which is not started yet from the specification, like New does. The options are applied after the ones derived from the specification.
+func NewProcessFromSpec(spec ExecSpec, opts ...Option) (*Process, error) {
+	specOpts := []Option{WithDir(spec.Dir)}
+	if spec.Env != nil {
+		specOpts = append(specOpts, WithEnv(maps.Clone(spec.Env)))
+	}
+	return New(spec.Args, append(specOpts, opts...)...)
+}
+
+// Redacted returns a copy of the specification with the arguments and the values of the environment variables passed through the redactor (see WithRedactor), e.g. for logging. A redacted specification is not suitable for launching the process anymore.
+func (s ExecSpec) Redacted(redactor func([]byte) []byte) ExecSpec {
+	redacted := ExecSpec{Dir: s.Dir}
+	for _, arg := range s.Args {
+		redacted.Args = append(redacted.Args, string(redactor([]byte(arg))))
+	}
+	if s.Env != nil {
+		redacted.Env = make(map[string]string, len(s.Env))
+		for name, value := range s.Env {
+			redacted.Env[name] = string(redactor([]byte(value)))
+		}
+	}
+	return redacted
+}
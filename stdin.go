@@ -0,0 +1,354 @@
+package goprocess
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+// writeRequest is a message written synchronously by WriteLine or WriteLineContext.
+type writeRequest struct {
+	msg []byte
+	// ctx aborts the write, it is nil if the write cannot be aborted
+	ctx    context.Context
+	result chan<- error
+}
+
+// sendStdin writes the messages of the stdin-channel, of WriteLine and the heartbeats to the stdin-pipe, one at a time.
+func (p *Process) sendStdin(stdinWriter io.Writer) {
+	go func() {
+		defer close(p.stdinDone)
+		var progress *progressWriter
+		if p.options.stdinProgress != nil {
+			progress = &progressWriter{writer: stdinWriter, report: p.options.stdinProgress}
+			stdinWriter = progress
+		}
+		if p.options.stdinStallThreshold > 0 {
+			stdinWriter = &stallWriter{writer: stdinWriter, threshold: p.options.stdinStallThreshold, report: p.reportError}
+		}
+		if p.options.stdinPrologue != nil {
+			p.audit(p.options.stdinPrologue)
+			stdinWriter.Write(p.options.stdinPrologue)
+		}
+		var heartbeat <-chan time.Time
+		if p.options.heartbeatInterval > 0 {
+			ticker := time.NewTicker(p.options.heartbeatInterval)
+			defer ticker.Stop()
+			heartbeat = ticker.C
+		}
+		done := p.done
+		// unsent is the number of messages of the stdin-channel which could not be written because the process exited
+		var unsent int
+	sendloop:
+		for {
+			select {
+			case msg, ok := <-p.stdin:
+				if !ok {
+					break sendloop
+				}
+				err := p.writeLine(stdinWriter, msg)
+				if err != nil && p.exitedBeforeWrite() {
+					unsent++
+				}
+				if err != nil && !p.stdinRejected(err) {
+					p.reportError(fmt.Errorf("%w: %w", ErrStdinWrite, err))
+				}
+			case request := <-p.writeRequests:
+				err := p.writeLineContext(request.ctx, stdinWriter, request.msg)
+				p.stdinRejected(err)
+				request.result <- err
+			case <-heartbeat:
+				err := p.writeLine(stdinWriter, p.options.heartbeat)
+				if err != nil && !p.stdinRejected(err) {
+					p.reportError(fmt.Errorf("%w: %w", ErrStdinWrite, err))
+				}
+			case <-done:
+				// stop the heartbeat, the stdin-channel is still consumed until it is closed
+				heartbeat = nil
+				done = nil
+			}
+		}
+		if p.options.stdinEpilogue != nil {
+			p.audit(p.options.stdinEpilogue)
+			stdinWriter.Write(p.options.stdinEpilogue)
+		}
+		if progress != nil {
+			progress.report(progress.written)
+		}
+		p.closeStdin()
+		if unsent > 0 {
+			p.reportError(&StdinTruncatedError{Unsent: unsent})
+		}
+	}()
+}
+
+// exitedReapGrace is how long a failed write waits for the reaping of the process if it cannot be told otherwise whether the process has exited.
+const exitedReapGrace = 100 * time.Millisecond
+
+// exitedBeforeWrite returns whether a write failed because the process has exited, as opposed to a process which is still running (e.g. because it closed its stdin). The process may have exited without having been reaped yet: on Linux, this is checked without reaping it; on other platforms, the write waits shortly for the reaping.
+func (p *Process) exitedBeforeWrite() bool {
+	if p.exited() {
+		return true
+	}
+	exited, err := processExited(p.command.Process.Pid)
+	if err == nil {
+		return exited
+	}
+	timer := time.NewTimer(exitedReapGrace)
+	defer timer.Stop()
+	select {
+	case <-p.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// exited returns whether the process has exited and has been reaped.
+func (p *Process) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// stdinProgressInterval is the minimum interval between two reports of WithStdinProgress.
+const stdinProgressInterval = 100 * time.Millisecond
+
+// progressWriter counts the bytes written to the stdin-pipe and reports them at most once per stdinProgressInterval.
+type progressWriter struct {
+	writer   io.Writer
+	report   func(written int64)
+	written  int64
+	reported time.Time
+}
+
+func (w *progressWriter) Write(data []byte) (int, error) {
+	n, err := w.writer.Write(data)
+	w.written += int64(n)
+	if now := time.Now(); now.Sub(w.reported) >= stdinProgressInterval {
+		w.reported = now
+		w.report(w.written)
+	}
+	return n, err
+}
+
+// stallWriter reports a write to the stdin-pipe which is pending longer than the threshold, once per write.
+type stallWriter struct {
+	writer    io.Writer
+	threshold time.Duration
+	report    func(err error)
+}
+
+func (w *stallWriter) Write(data []byte) (int, error) {
+	timer := time.AfterFunc(w.threshold, func() {
+		w.report(fmt.Errorf("%w: write of %d bytes pending for %v", ErrStdinStalled, len(data), w.threshold))
+	})
+	defer timer.Stop()
+	return w.writer.Write(data)
+}
+
+// stdinRejected returns whether the error of a write means that the process closed its end of the stdin-pipe (EPIPE). The first time, StdinClosedByProcess is closed and an error wrapping ErrStdinClosedByProcess is reported; further writes failing for the same reason are not reported.
+func (p *Process) stdinRejected(err error) bool {
+	if !errors.Is(err, syscall.EPIPE) {
+		return false
+	}
+	p.stdinClosedByProcessOnce.Do(func() {
+		close(p.stdinClosedByProcess)
+		p.reportError(fmt.Errorf("%w: %w: %w", ErrStdinClosedByProcess, ErrStdinWrite, err))
+	})
+	return true
+}
+
+// StdinClosedByProcess returns a channel which is closed once a write to stdin failed because the process closed its end of the stdin-pipe, e.g. because it exited or does not accept input anymore although it may still produce output. The messages written afterwards are dropped (WriteLine returns the error). An error wrapping ErrStdinClosedByProcess is reported once on the channel returned by Errors instead of an error for every dropped message.
+func (p *Process) StdinClosedByProcess() <-chan struct{} {
+	return p.stdinClosedByProcess
+}
+
+// closeStdin closes the stdin-pipe. It may be called multiple times.
+func (p *Process) closeStdin() {
+	p.stdinClosed.Store(true)
+	p.stdinWriter.Close()
+}
+
+// StdinDone returns a channel which is closed once the stdin-channel has been closed and drained, all messages (and the epilogue of WithStdinEpilogue) have been written and the stdin-pipe has been closed. It allows sequencing a shutdown precisely, e.g. closing the stdin-channel, waiting for the flush and signaling the process afterwards. With WithStdinSource, it is closed right after the start.
+func (p *Process) StdinDone() <-chan struct{} {
+	return p.stdinDone
+}
+
+// WaitStdinConsumed waits until the process presumably consumed everything written to its stdin: first until the stdin-channel has been closed and all messages have been written (see StdinDone), then until the process closed its output (see OutputsClosed) or wrote the sentinel set by WithConsumedSentinel, whichever happens first. It returns the error of the context if the context is done before.
+//
+// This is a heuristic. A written message has only reached the pipe buffer, and closing the output or exiting does not prove that the process handled its input (it may have failed or ignored it); descendants keeping the output open delay the return. A reliable confirmation requires an acknowledgement by the protocol of the application, e.g. a response per request, and the sentinel is the way to wait for one.
+func (p *Process) WaitStdinConsumed(ctx context.Context) error {
+	p.mutex.Lock()
+	started := p.started
+	p.mutex.Unlock()
+	if !started {
+		return ErrNotStarted
+	}
+	select {
+	case <-p.stdinDone:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-p.outputsClosed:
+	case <-p.sentinelRead:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// StdinOpen returns whether the stdin-pipe of the process still accepts writes, i.e. the process has been started, has not exited and its stdin-pipe has not been closed (by closing the stdin-channel or by Kill). It allows avoiding messages being dropped silently because the process has gone away. The result is a snapshot: the process may exit right after StdinOpen returned. A process which closed its end of the pipe while still running is only detected by a failed write, see StdinClosedByProcess.
+func (p *Process) StdinOpen() bool {
+	p.mutex.Lock()
+	started := p.started
+	p.mutex.Unlock()
+	if !started || p.stdinClosed.Load() {
+		return false
+	}
+	select {
+	case <-p.done:
+		return false
+	case <-p.stdinClosedByProcess:
+		return false
+	default:
+		return true
+	}
+}
+
+// writeLine writes the message followed by a newline, or with WithStdinSeparator preceded by the separator unless it is the first message. It is only called by the goroutine writing stdin.
+func (p *Process) writeLine(stdinWriter io.Writer, msg []byte) error {
+	if p.options.stdinSeparator != nil {
+		if p.stdinWritten {
+			msg = append(p.options.stdinSeparator[:len(p.options.stdinSeparator):len(p.options.stdinSeparator)], msg...)
+		}
+		p.stdinWritten = true
+	} else {
+		// limit the capacity, so that appending does not write into the array of the caller
+		msg = append(msg[:len(msg):len(msg)], '\n')
+	}
+	p.audit(msg)
+	return p.write(stdinWriter, msg)
+}
+
+// write writes the data to the stdin-pipe, retrying transient errors as configured by WithStdinRetry. A retry continues after the data written so far.
+func (p *Process) write(stdinWriter io.Writer, data []byte) error {
+	backoff := p.options.stdinBackoff
+	for attempt := 0; ; attempt++ {
+		n, err := stdinWriter.Write(data)
+		if err == nil || attempt >= p.options.stdinRetries || !retryable(err) {
+			return err
+		}
+		data = data[n:]
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// writeLineContext writes the message like writeLine, but aborts the write once the context is done. The write is interrupted by a deadline of the stdin-pipe.
+func (p *Process) writeLineContext(ctx context.Context, stdinWriter io.Writer, msg []byte) error {
+	if ctx == nil {
+		return p.writeLine(stdinWriter, msg)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// aborted is closed once the deadline has been set
+	aborted := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		p.stdinWriter.SetWriteDeadline(time.Unix(1, 0))
+		close(aborted)
+	})
+	err := p.writeLine(stdinWriter, msg)
+	if stop() {
+		return err
+	}
+	// the write has been aborted or the context was done right after the write: the deadline may still be in the process of being set and must not outlive the reset
+	<-aborted
+	p.stdinWriter.SetWriteDeadline(time.Time{})
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		// the process may have read a part of the message, the rest must not be mistaken for the next message
+		p.closeStdin()
+		return ctx.Err()
+	}
+	return err
+}
+
+// WriteLine writes a message followed by a newline to the stdin of the process and returns once the message has been written to the stdin-pipe, with the error of the write.
+//
+// Unlike a send on the stdin-channel, which completes as soon as the message has been handed over and hides write errors, WriteLine provides backpressure: a producer calling it is slowed down to the pace at which the process reads its stdin (plus the capacity of the pipe). The price is latency, since every call waits for the write. Messages of WriteLine and the stdin-channel are written one after another, never interleaved. After the stdin-channel has been closed, WriteLine returns ErrStdinClosed.
+func (p *Process) WriteLine(msg []byte) error {
+	return p.requestWrite(nil, msg)
+}
+
+// EndRequest marks the end of a request on stdin by writing the delimiter line set by WithRequestDelimiter like WriteLine, without closing the stdin-pipe. It returns ErrNoRequestDelimiter if no delimiter has been set.
+func (p *Process) EndRequest() error {
+	if p.options.requestDelimiter == nil {
+		return ErrNoRequestDelimiter
+	}
+	return p.WriteLine(p.options.requestDelimiter)
+}
+
+// WriteJSON marshals the value to JSON and writes it as a single line to the stdin of the process like WriteLine, e.g. for protocols based on newline-delimited JSON. If the value cannot be marshaled, the error is returned and nothing is written.
+func (p *Process) WriteJSON(v any) error {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return p.WriteLine(msg)
+}
+
+// WriteLineContext is like WriteLine, but the write is abandoned once the context is done, e.g. when a user cancels a large paste. A message which has not been started is dropped and the error of the context is returned.
+//
+// If the write is abandoned while it is in progress, the process has already read a part of the message. Since the rest of the message cannot be told apart from the following messages anymore, the stdin-pipe is closed: the process sees a truncated message without newline followed by the end of its input, and later writes fail. This also applies if the process has not read anything yet when the write is abandoned.
+func (p *Process) WriteLineContext(ctx context.Context, msg []byte) error {
+	return p.requestWrite(ctx, msg)
+}
+
+// requestWrite passes the message to the goroutine writing stdin and waits for the result of the write. The context is nil if the write cannot be abandoned.
+func (p *Process) requestWrite(ctx context.Context, msg []byte) error {
+	p.mutex.Lock()
+	started := p.started
+	p.mutex.Unlock()
+	if !started {
+		return ErrNotStarted
+	}
+	var ctxDone <-chan struct{}
+	if ctx != nil {
+		ctxDone = ctx.Done()
+	}
+	result := make(chan error, 1)
+	select {
+	case p.writeRequests <- writeRequest{msg: msg, ctx: ctx, result: result}:
+		return <-result
+	case <-p.stdinDone:
+		return ErrStdinClosed
+	case <-ctxDone:
+		return ctx.Err()
+	}
+}
+
+// audit writes data sent to stdin to the audit writer. Errors of the audit writer are ignored, they must not break the stdin of the process.
+func (p *Process) audit(data []byte) {
+	if p.options.stdinAudit == nil {
+		return
+	}
+	p.options.stdinAudit.Write(p.redact(data))
+}
+
+// redact applies the redactor to data written to a sink like the audit writer. The data sent to the process or delivered to the caller is never redacted.
+func (p *Process) redact(data []byte) []byte {
+	if p.options.redactor == nil {
+		return data
+	}
+	return p.options.redactor(append([]byte(nil), data...))
+}
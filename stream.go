@@ -0,0 +1,134 @@
+package goprocess
+
+import (
+	"iter"
+	"sync"
+)
+
+// OutStream wraps an output channel of a process with helpers for the common consumption patterns.
+type OutStream struct {
+	// C is the underlying channel, accessible for advanced use like select statements.
+	C <-chan []byte
+}
+
+// StdoutStream returns the stdout-channel wrapped in an OutStream.
+func (p *Process) StdoutStream() OutStream {
+	return OutStream{C: p.Stdout()}
+}
+
+// StderrStream returns the stderr-channel wrapped in an OutStream.
+func (p *Process) StderrStream() OutStream {
+	return OutStream{C: p.Stderr()}
+}
+
+// Lines returns an iterator over the lines of the stream until the channel is closed:
+//
+//	for line := range p.StdoutStream().Lines() {
+//		// handle line
+//	}
+//
+// Breaking out of the loop stops receiving; the lines which are not received remain in the channel.
+func (s OutStream) Lines() iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		for line := range s.C {
+			if !yield(line) {
+				return
+			}
+		}
+	}
+}
+
+// Collect receives all lines of the stream until the channel is closed and returns them.
+func (s OutStream) Collect() [][]byte {
+	var lines [][]byte
+	for line := range s.C {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// ForEach calls f for every line of the stream until the channel is closed.
+func (s OutStream) ForEach(f func([]byte)) {
+	for line := range s.C {
+		f(line)
+	}
+}
+
+// BreakPolicy determines what happens when the consumer breaks out of a loop over StdoutSeq or StderrSeq.
+type BreakPolicy int
+
+const (
+	// BreakDrain discards the remaining lines of the stream in the background until the channel is closed, so the process is not blocked by a full pipe. This is the default.
+	BreakDrain BreakPolicy = iota
+	// BreakTerminate terminates the process gracefully (see Process.Terminate) and discards the remaining lines of the stream.
+	BreakTerminate
+	// BreakKeep leaves the remaining lines in the channel for another consumer.
+	BreakKeep
+)
+
+// StdoutSeq returns an iterator over the lines of stdout:
+//
+//	for line := range p.StdoutSeq() {
+//		if done(line) {
+//			break
+//		}
+//	}
+//
+// Breaking out of the loop applies the policy set by WithBreakPolicy. The goroutine draining the stream in the background ends when the channel is closed.
+func (p *Process) StdoutSeq() iter.Seq[[]byte] {
+	return p.seq(p.Stdout())
+}
+
+// StderrSeq returns an iterator over the lines of stderr. See StdoutSeq.
+func (p *Process) StderrSeq() iter.Seq[[]byte] {
+	return p.seq(p.Stderr())
+}
+
+func (p *Process) seq(lines <-chan []byte) iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		for line := range lines {
+			if !yield(line) {
+				p.afterBreak(lines)
+				return
+			}
+		}
+	}
+}
+
+func (p *Process) afterBreak(lines <-chan []byte) {
+	switch p.options.breakPolicy {
+	case BreakDrain:
+		go Drain(lines)
+	case BreakTerminate:
+		go p.Terminate(p.options.gracePeriod)
+		go Drain(lines)
+	}
+}
+
+// Drain receives and discards the lines of the channel until it is closed. It returns immediately if the channel is nil.
+//
+// A stream which is not consumed is not harmless: once the channel buffer and the pipe are full, the process blocks on its next write and may never exit. A stream which is of no interest therefore has to be drained, e.g. by go Drain(p.Stderr()).
+func Drain(lines <-chan []byte) {
+	if lines == nil {
+		return
+	}
+	for range lines {
+	}
+}
+
+// DrainAll receives and discards all output of the process, i.e. the lines of the stdout- and stderr-channels and of the channel returned by Lines, until the channels are closed. The channels are drained concurrently, so a full pipe of one stream cannot block draining the other. It is meant for shutdown paths, where the output is of no interest anymore but the process must be able to finish.
+func DrainAll(p *Process) {
+	var wg sync.WaitGroup
+	for _, lines := range []<-chan []byte{p.Stdout(), p.Stderr()} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Drain(lines)
+		}()
+	}
+	if p.Lines() != nil {
+		for range p.Lines() {
+		}
+	}
+	wg.Wait()
+}
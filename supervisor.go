@@ -0,0 +1,422 @@
+package goprocess
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRestartLimit is reported by a supervisor which gave up restarting its process because the restart limit set by WithRestartLimit has been exceeded.
+var ErrRestartLimit = errors.New("restart limit exceeded")
+
+// SupervisorOption configures a supervisor created by NewSupervisor.
+type SupervisorOption func(*supervisorOptions)
+
+type supervisorOptions struct {
+	maxRestarts   int
+	restartWindow time.Duration
+
+	backoffInitial time.Duration
+	backoffMax     time.Duration
+	stableWindow   time.Duration
+
+	preRestart  func()
+	postRestart func(attempt int)
+
+	replayLines     int
+	replayAutomatic bool
+
+	clock Clock
+}
+
+// Defaults of the backoff between restarts, see WithRestartBackoff.
+const (
+	DefaultRestartBackoff    = 100 * time.Millisecond
+	DefaultRestartBackoffMax = 10 * time.Second
+)
+
+// WithRestartLimit limits the number of restarts: if the process would be restarted more than max times within the window, the supervisor gives up instead and reports ErrRestartLimit. A window of 0 limits the restarts over the lifetime of the supervisor. By default, the restarts are not limited.
+func WithRestartLimit(max int, window time.Duration) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.maxRestarts = max
+		o.restartWindow = window
+	}
+}
+
+// WithRestartBackoff sets the delay before a restart. The delay starts with initial and doubles with every consecutive failure to start the process, up to max. It is reset once the process has been started successfully, or with WithStableWindow, once the process stayed alive for the stable window.
+func WithRestartBackoff(initial, max time.Duration) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.backoffInitial = initial
+		o.backoffMax = max
+	}
+}
+
+// WithStableWindow considers a restart successful only if the process stays alive for at least the window: the backoff of WithRestartBackoff is reset once the window elapsed, while a process exiting earlier (e.g. crashing right after its start) lets the backoff grow further. This prevents a tight crash loop from masquerading as healthy restarts.
+func WithStableWindow(window time.Duration) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.stableWindow = window
+	}
+}
+
+// WithPreRestart calls the function before every restart, after the delay of the backoff and before the new process is created, e.g. to rotate a log file. The function runs synchronously and may block the restart until the environment is ready. If the supervisor is stopped meanwhile, the process is not restarted anymore.
+func WithPreRestart(f func()) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.preRestart = f
+	}
+}
+
+// WithPostRestart calls the function after every successful restart with the number of the restart attempt (see Supervisor.Restarts), e.g. to notify a coordinator. The function runs synchronously, so the supervisor does not notice an exit of the new process before the function returned.
+func WithPostRestart(f func(attempt int)) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.postRestart = f
+	}
+}
+
+// WithStdinReplay records the last n messages written by Supervisor.WriteLine, so that they can be re-sent to a restarted process by Supervisor.ReplayStdin, e.g. to resume a session. With automatic, the messages are replayed after every successful restart, before the function of WithPostRestart is called.
+//
+// The supervisor cannot know which messages the previous process has already processed: a replayed message may be processed twice, so the protocol must tolerate duplicates (e.g. by idempotent messages or sequence numbers the process checks).
+func WithStdinReplay(n int, automatic bool) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.replayLines = n
+		o.replayAutomatic = automatic
+	}
+}
+
+// WithSupervisorClock sets the clock of the backoff between restarts and of the restart window of WithRestartLimit. By default, the clock of the time package is used. The timers of the processes are configured by WithClock.
+func WithSupervisorClock(clock Clock) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.clock = clock
+	}
+}
+
+// Supervisor runs a process and restarts it whenever it exits, until the supervisor is stopped or gives up. Every (re)start creates a fresh process by calling the function passed to NewSupervisor, so options like WithEnvFunc are evaluated again.
+//
+// The lines of the stdout- and stderr-channels of all processes are forwarded to the channels of the supervisor, which stay open across restarts. The output of processes delivered by WithLines or callbacks is not forwarded.
+type Supervisor struct {
+	newProcess func() (*Process, error)
+	options    supervisorOptions
+
+	stdout chan []byte
+	stderr chan []byte
+	errors chan error
+	// forwarders counts the goroutines forwarding output to the channels of the supervisor
+	forwarders sync.WaitGroup
+
+	mutex    sync.Mutex
+	started  bool
+	process  *Process
+	restarts int
+	// restartTimes are the times of the restarts within the restart window
+	restartTimes []time.Time
+	err          error
+	// replay retains the messages of WriteLine, it is nil if WithStdinReplay is not given
+	replay *ring
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewSupervisor creates a new supervisor which is not started yet. The function creates a new process which is not started yet, e.g.:
+//
+//	supervisor := NewSupervisor(func() (*Process, error) {
+//		return New([]string{"server"}, WithEnvFunc(credentials))
+//	}, WithRestartLimit(5, time.Minute))
+func NewSupervisor(newProcess func() (*Process, error), opts ...SupervisorOption) *Supervisor {
+	s := &Supervisor{
+		newProcess: newProcess,
+		options:    supervisorOptions{backoffInitial: DefaultRestartBackoff, backoffMax: DefaultRestartBackoffMax, clock: realClock{}},
+		stdout:     make(chan []byte, 1024),
+		stderr:     make(chan []byte, 1024),
+		errors:     make(chan error, errorsBufferSize),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&s.options)
+	}
+	if s.options.replayLines > 0 {
+		s.replay = newRing(s.options.replayLines)
+	}
+	return s
+}
+
+// Start starts the process and supervises it in the background. It returns the error if the first process cannot be created or started, in which case nothing is supervised.
+func (s *Supervisor) Start() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.started {
+		return ErrAlreadyStarted
+	}
+	p, err := s.startProcess()
+	if err != nil {
+		return err
+	}
+	s.started = true
+	s.process = p
+	go s.supervise(p)
+	return nil
+}
+
+// Stop stops supervising: the current process is terminated gracefully (see WithGracePeriod) and not restarted anymore. Stop returns once the supervisor is done. Unlike a supervisor which gave up, a stopped supervisor reports no error by Err.
+func (s *Supervisor) Stop() error {
+	s.mutex.Lock()
+	started := s.started
+	s.mutex.Unlock()
+	if !started {
+		return ErrNotStarted
+	}
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	s.mutex.Lock()
+	p := s.process
+	s.mutex.Unlock()
+	p.Terminate(p.options.gracePeriod)
+	<-s.done
+	return nil
+}
+
+// Stdout returns the channel on which the lines written by the processes to their stdout are received. The channel is closed after the supervisor is done and all output has been forwarded.
+func (s *Supervisor) Stdout() <-chan []byte {
+	return s.stdout
+}
+
+// Stderr returns the channel on which the lines written by the processes to their stderr are received. See Stdout.
+func (s *Supervisor) Stderr() <-chan []byte {
+	return s.stderr
+}
+
+// Errors returns a channel on which the errors of the supervision are reported: failures to restart the process and finally ErrRestartLimit if the supervisor gives up. The errors are sent without blocking, if the channel is full they are dropped. The channel is never closed.
+func (s *Supervisor) Errors() <-chan error {
+	return s.errors
+}
+
+// Done returns a channel which is closed when the supervisor is done, i.e. it has been stopped or gave up and the last process has exited.
+func (s *Supervisor) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the supervisor gave up: ErrRestartLimit once the restart limit has been exceeded. It returns nil while supervising and after the supervisor has been stopped by Stop.
+func (s *Supervisor) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err
+}
+
+// Process returns the current process. It returns nil before the supervisor has been started.
+//
+// Once a process exited, the supervisor closes the stdin- and signals-channels owned by it (see Process.Stdin and Process.Signals), so nothing may be sent on them: write stdin by WriteLine and stop the process by Stop instead.
+func (s *Supervisor) Process() *Process {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.process
+}
+
+// Restarts returns the number of restarts of the process so far, including attempts which failed to start the process.
+func (s *Supervisor) Restarts() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.restarts
+}
+
+// WriteLine writes a message followed by a newline to the stdin of the current process like Process.WriteLine. With WithStdinReplay, the message is recorded for replay, even if the write fails because the process is exiting.
+func (s *Supervisor) WriteLine(msg []byte) error {
+	p := s.Process()
+	if p == nil {
+		return ErrNotStarted
+	}
+	if s.replay != nil {
+		s.replay.add(msg)
+	}
+	return p.WriteLine(msg)
+}
+
+// ReplayStdin re-sends the messages recorded by WithStdinReplay to the current process, oldest first, and returns the first error of the writes. Messages written by WriteLine meanwhile may interleave with the replayed ones.
+func (s *Supervisor) ReplayStdin() error {
+	p := s.Process()
+	if p == nil {
+		return ErrNotStarted
+	}
+	return s.replayTo(p)
+}
+
+// replayTo re-sends the recorded messages to the process.
+func (s *Supervisor) replayTo(p *Process) error {
+	if s.replay == nil {
+		return nil
+	}
+	for _, msg := range s.replay.last(s.replay.size()) {
+		err := p.WriteLine(msg)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startProcess creates and starts a new process and forwards its output.
+func (s *Supervisor) startProcess() (*Process, error) {
+	p, err := s.newProcess()
+	if err != nil {
+		return nil, err
+	}
+	err = p.Start()
+	if err != nil {
+		return nil, err
+	}
+	s.forward(p, p.Stdout(), s.stdout)
+	s.forward(p, p.Stderr(), s.stderr)
+	return p, nil
+}
+
+// forward forwards the lines of the channel of the process to the channel of the supervisor until the channel of the process is closed.
+func (s *Supervisor) forward(p *Process, lines <-chan []byte, target chan<- []byte) {
+	if lines == nil {
+		return
+	}
+	s.forwarders.Add(1)
+	go func() {
+		defer s.forwarders.Done()
+		for line := range lines {
+			target <- ownLine(p, line)
+		}
+	}()
+}
+
+// supervise restarts the process whenever it exits until the supervisor is stopped or the restart limit is exceeded.
+func (s *Supervisor) supervise(p *Process) {
+	defer func() {
+		close(s.done)
+		go func() {
+			s.forwarders.Wait()
+			close(s.stdout)
+			close(s.stderr)
+		}()
+	}()
+	backoff := s.options.backoffInitial
+	for {
+		if s.options.stableWindow > 0 {
+			backoff = s.waitStable(p, backoff)
+		}
+		<-p.Done()
+		release(p)
+		for {
+			if s.stopped() {
+				return
+			}
+			if !s.allowRestart() {
+				s.mutex.Lock()
+				s.err = ErrRestartLimit
+				s.mutex.Unlock()
+				s.reportError(ErrRestartLimit)
+				return
+			}
+			timer := s.options.clock.NewTimer(backoff)
+			select {
+			case <-s.stop:
+				timer.Stop()
+				return
+			case <-timer.C():
+			}
+			if s.options.preRestart != nil {
+				s.options.preRestart()
+				if s.stopped() {
+					return
+				}
+			}
+			next, err := s.startProcess()
+			if err == nil {
+				p = next
+				if s.options.stableWindow > 0 {
+					// the restart only counts as successful once the process is stable
+					backoff = min(2*backoff, s.options.backoffMax)
+				} else {
+					backoff = s.options.backoffInitial
+				}
+				s.mutex.Lock()
+				s.process = p
+				s.mutex.Unlock()
+				if s.options.replayAutomatic {
+					if err := s.replayTo(p); err != nil {
+						s.reportError(err)
+					}
+				}
+				if s.options.postRestart != nil {
+					s.options.postRestart(s.Restarts())
+				}
+				break
+			}
+			s.reportError(err)
+			backoff = min(2*backoff, s.options.backoffMax)
+		}
+		if s.stopped() {
+			// Stop may have missed the new process
+			p.Terminate(p.options.gracePeriod)
+		}
+	}
+}
+
+// release closes the stdin- and signals-channels owned by the exited process, which ends the goroutines consuming them and closes the stdin-pipe. Nobody else sends on them: the supervisor writes stdin by WriteLine.
+func release(p *Process) {
+	if stdin := p.Stdin(); stdin != nil {
+		close(stdin)
+	}
+	if signals := p.Signals(); signals != nil {
+		close(signals)
+	}
+}
+
+// waitStable waits until the process stayed alive for the stable window or exited. It returns the initial backoff if the process is stable, the given backoff otherwise.
+func (s *Supervisor) waitStable(p *Process, backoff time.Duration) time.Duration {
+	timer := s.options.clock.NewTimer(s.options.stableWindow)
+	select {
+	case <-timer.C():
+		return s.options.backoffInitial
+	case <-p.Done():
+		timer.Stop()
+		return backoff
+	}
+}
+
+// stopped returns whether Stop has been called.
+func (s *Supervisor) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// allowRestart records a restart and returns whether it is within the restart limit.
+func (s *Supervisor) allowRestart() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := s.options.clock.Now()
+	if s.options.restartWindow > 0 {
+		recent := s.restartTimes[:0]
+		for _, restart := range s.restartTimes {
+			if now.Sub(restart) < s.options.restartWindow {
+				recent = append(recent, restart)
+			}
+		}
+		s.restartTimes = recent
+	}
+	if s.options.maxRestarts > 0 && len(s.restartTimes) >= s.options.maxRestarts {
+		return false
+	}
+	if s.options.maxRestarts > 0 {
+		s.restartTimes = append(s.restartTimes, now)
+	}
+	s.restarts++
+	return true
+}
+
+// reportError sends the error on the error channel, dropping it if the channel is full.
+func (s *Supervisor) reportError(err error) {
+	select {
+	case s.errors <- err:
+	default:
+	}
+}
@@ -0,0 +1,52 @@
+package goprocess
+
+import (
+	"fmt"
+	"io"
+)
+
+// SetStdoutTee starts writing the lines of stdout to the writer in addition to delivering them, e.g. to capture the output into a file on demand or to reopen a log file on SIGHUP without restarting the process. The lines are written as delivered, including the header of WithHeaderLine, terminated by a newline (chunks of WithFixedChunkSize and the output of WithStdoutWhole are written as they are). Like every sink of the output, the tee receives the lines after the redactor of WithRedactor has been applied. A previously set writer is replaced. The writer is called by the goroutine reading stdout, so a slow writer slows down reading. A failed write is reported on the channel returned by Process.Errors, wrapping ErrTeeWrite; the writer is kept.
+//
+// It is safe to call at any time, also concurrently with the process writing output.
+func (p *Process) SetStdoutTee(writer io.Writer) {
+	p.stdout.setTee(writer)
+}
+
+// ClearStdoutTee stops writing the lines of stdout to the writer set by SetStdoutTee. Once it returned, the writer is not written anymore, so it can be closed right away.
+func (p *Process) ClearStdoutTee() {
+	p.stdout.setTee(nil)
+}
+
+// SetStderrTee starts writing the lines of stderr to the writer in addition to delivering them. See SetStdoutTee.
+func (p *Process) SetStderrTee(writer io.Writer) {
+	p.stderr.setTee(writer)
+}
+
+// ClearStderrTee stops writing the lines of stderr to the writer set by SetStderrTee. See ClearStdoutTee.
+func (p *Process) ClearStderrTee() {
+	p.stderr.setTee(nil)
+}
+
+// setTee replaces the writer of the tee. It waits for a pending write of the previous writer.
+func (o *output) setTee(writer io.Writer) {
+	o.teeMutex.Lock()
+	defer o.teeMutex.Unlock()
+	o.tee = writer
+}
+
+// writeTee writes the redacted line to the writer of the tee if one is set. A newline is appended to lines of a line-based stream which do not end with one.
+func (p *Process) writeTee(o *output, line []byte) {
+	o.teeMutex.Lock()
+	defer o.teeMutex.Unlock()
+	if o.tee == nil {
+		return
+	}
+	data := p.redact(line)
+	lineBased := !o.chunked(p) && !(o.stream == StreamStdout && p.options.stdoutWhole)
+	if lineBased && (len(data) == 0 || data[len(data)-1] != '\n') {
+		data = append(append(make([]byte, 0, len(data)+1), data...), '\n')
+	}
+	if _, err := o.tee.Write(data); err != nil {
+		p.reportError(fmt.Errorf("%w: %w", ErrTeeWrite, err))
+	}
+}
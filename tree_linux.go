@@ -0,0 +1,42 @@
+package goprocess
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+)
+
+// parentPids returns the parent pids of all processes by pid, read from /proc.
+func parentPids() (map[int]int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	parents := make(map[int]int)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			// the process exited in the meantime
+			continue
+		}
+		// the format is "pid (comm) state ppid ...", where comm may contain spaces and parentheses
+		end := bytes.LastIndexByte(stat, ')')
+		if end < 0 {
+			continue
+		}
+		fields := bytes.Fields(stat[end+1:])
+		if len(fields) < 2 {
+			continue
+		}
+		ppid, err := strconv.Atoi(string(fields[1]))
+		if err != nil {
+			continue
+		}
+		parents[pid] = ppid
+	}
+	return parents, nil
+}
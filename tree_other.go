@@ -0,0 +1,34 @@
+//go:build unix && !linux
+
+package goprocess
+
+import (
+	"bytes"
+	"os/exec"
+	"strconv"
+)
+
+// parentPids returns the parent pids of all processes by pid, listed by ps.
+func parentPids() (map[int]int, error) {
+	output, err := exec.Command("ps", "-A", "-o", "pid=", "-o", "ppid=").Output()
+	if err != nil {
+		return nil, err
+	}
+	parents := make(map[int]int)
+	for _, line := range bytes.Split(output, []byte("\n")) {
+		fields := bytes.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(string(fields[0]))
+		if err != nil {
+			continue
+		}
+		ppid, err := strconv.Atoi(string(fields[1]))
+		if err != nil {
+			continue
+		}
+		parents[pid] = ppid
+	}
+	return parents, nil
+}